@@ -4527,6 +4527,7 @@ class Node(CleanSave, TimestampedModel):
         """Restore the network interface to their commissioned state."""
         # Local import to avoid circular import problems.
         from metadataserver.builtin_scripts.hooks import (
+            unwrap_lxd_resources,
             update_node_network_information,
         )
 
@@ -4534,7 +4535,9 @@ class Node(CleanSave, TimestampedModel):
             script_name=LXD_OUTPUT_NAME
         )
         update_node_network_information(
-            self, json.loads(script.output), NUMANode.objects.filter(node=self)
+            self,
+            unwrap_lxd_resources(json.loads(script.output)),
+            NUMANode.objects.filter(node=self),
         )
 
     def set_initial_networking_configuration(self):
@@ -0,0 +1,29 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+// archUnsupported lists, for each GOARCH, the subsystems known to come back
+// empty there whatever the hardware, so that --arch-report can tell
+// consumers not to read anything into it. s390x and ppc64le have no SMBIOS
+// or EFI, and s390x has no USB, BMC, hwmon or power supply devices either.
+var archUnsupported = map[string][]string{
+	"ppc64le": {"dmi", "firmware"},
+	"s390x":   {"usb", "dmi", "firmware", "bmc", "power", "sensors"},
+}
+
+// unsupportedSubsystems returns which of the selected subsystems are known
+// not to work on arch, in collection order.
+func unsupportedSubsystems(arch string, selected []subsystem) []string {
+	unsupported := make(map[string]bool)
+	for _, name := range archUnsupported[arch] {
+		unsupported[name] = true
+	}
+	var names []string
+	for _, s := range selected {
+		if unsupported[s.name] {
+			names = append(names, s.name)
+		}
+	}
+	return names
+}
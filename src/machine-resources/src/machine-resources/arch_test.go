@@ -0,0 +1,49 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnsupportedSubsystems(t *testing.T) {
+	all, err := selectSubsystems(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	some, err := selectSubsystems([]string{"power", "dmi", "cpu"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		arch     string
+		selected []subsystem
+		want     []string
+	}{
+		{arch: "amd64", selected: all},
+		{arch: "arm64", selected: all},
+		{arch: "ppc64le", selected: all, want: []string{"dmi", "firmware"}},
+		{arch: "s390x", selected: all, want: []string{"usb", "dmi", "firmware", "bmc", "power", "sensors"}},
+		// Subsystems come back in collection order, whatever order
+		// they were asked for in.
+		{arch: "s390x", selected: some, want: []string{"dmi", "power"}},
+		{arch: "s390x", selected: nil},
+	}
+	for _, test := range tests {
+		got := unsupportedSubsystems(test.arch, test.selected)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("unsupportedSubsystems(%q, %d subsystems) = %v, want %v",
+				test.arch, len(test.selected), got, test.want)
+		}
+	}
+}
+
+func TestArchUnsupportedNames(t *testing.T) {
+	for arch, names := range archUnsupported {
+		if _, err := selectSubsystems(names, nil); err != nil {
+			t.Errorf("archUnsupported[%q]: %v", arch, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+)
+
+// ipmiDevicePaths are the device nodes the IPMI driver may create for the
+// BMC, depending on the udev rules in use.
+var ipmiDevicePaths = []string{"/dev/ipmi0", "/dev/ipmi/0", "/dev/ipmidev/0"}
+
+// bmc is the baseboard management controller. Device is its IPMI device
+// node, if one exists; everything else is only reported with --bmc, from
+// ipmitool, and is omitted if ipmitool can't talk to the BMC.
+type bmc struct {
+	Device          string  `json:"device,omitempty" yaml:"device,omitempty"`
+	IPMIVersion     string  `json:"ipmi_version,omitempty" yaml:"ipmi_version,omitempty"`
+	FirmwareVersion string  `json:"firmware_version,omitempty" yaml:"firmware_version,omitempty"`
+	Manufacturer    string  `json:"manufacturer,omitempty" yaml:"manufacturer,omitempty"`
+	ManufacturerID  *uint64 `json:"manufacturer_id,omitempty" yaml:"manufacturer_id,omitempty"`
+	ProductID       *uint64 `json:"product_id,omitempty" yaml:"product_id,omitempty"`
+	LAN             *bmcLAN `json:"lan,omitempty" yaml:"lan,omitempty"`
+}
+
+// bmcLAN is the network configuration of the BMC's LAN channel.
+// AddressSource is how it got its address, such as "DHCP Address" or
+// "Static Address".
+type bmcLAN struct {
+	AddressSource  string `json:"address_source,omitempty" yaml:"address_source,omitempty"`
+	IPAddress      string `json:"ip_address,omitempty" yaml:"ip_address,omitempty"`
+	SubnetMask     string `json:"subnet_mask,omitempty" yaml:"subnet_mask,omitempty"`
+	MACAddress     string `json:"mac_address,omitempty" yaml:"mac_address,omitempty"`
+	DefaultGateway string `json:"default_gateway,omitempty" yaml:"default_gateway,omitempty"`
+}
+
+// parseIPMIFields parses the "Name : value" lines ipmitool prints for mc
+// info and lan print. Indented lines continue a list under the previous
+// field, and are skipped.
+func parseIPMIFields(data []byte) map[string]string {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		if name, value, found := strings.Cut(line, ":"); found {
+			fields[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return fields
+}
+
+// parseIPMIID parses an ID as ipmitool prints it, which is decimal with
+// the hex sometimes following, as in "2167 (0x0877)".
+func parseIPMIID(value string) *uint64 {
+	if fields := strings.Fields(value); len(fields) > 0 {
+		if id, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			return &id
+		}
+	}
+	return nil
+}
+
+// parseIPMIMcInfo fills in b from `ipmitool mc info` output.
+func parseIPMIMcInfo(data []byte, b *bmc) {
+	fields := parseIPMIFields(data)
+	b.IPMIVersion = fields["IPMI Version"]
+	b.FirmwareVersion = fields["Firmware Revision"]
+	b.Manufacturer = fields["Manufacturer Name"]
+	b.ManufacturerID = parseIPMIID(fields["Manufacturer ID"])
+	b.ProductID = parseIPMIID(fields["Product ID"])
+}
+
+// parseIPMILanPrint parses `ipmitool lan print` output, returning nil if it
+// has no address details.
+func parseIPMILanPrint(data []byte) *bmcLAN {
+	fields := parseIPMIFields(data)
+	lan := &bmcLAN{
+		AddressSource:  fields["IP Address Source"],
+		IPAddress:      fields["IP Address"],
+		SubnetMask:     fields["Subnet Mask"],
+		MACAddress:     fields["MAC Address"],
+		DefaultGateway: fields["Default Gateway IP"],
+	}
+	if *lan == (bmcLAN{}) {
+		return nil
+	}
+	return lan
+}
+
+// getBMC detects the BMC from its IPMI device node or sysfs class, returning
+// nil if there's none. With opts.bmc it adds what ipmitool reports about
+// the BMC and its LAN channel.
+func getBMC(devicePaths []string, opts *collectOptions) (*bmc, error) {
+	b := &bmc{}
+	for _, path := range devicePaths {
+		if exists(path) {
+			b.Device = path
+			break
+		}
+	}
+	// The class is there whenever the IPMI driver is loaded, but only has
+	// an entry once the driver found an interface to a BMC.
+	if b.Device == "" && len(listDir(sysfsPath("class/ipmi"))) == 0 {
+		return nil, nil
+	}
+	if !opts.bmc {
+		return b, nil
+	}
+	if data, err := opts.run("ipmitool", "mc", "info"); err == nil {
+		parseIPMIMcInfo(data, b)
+	}
+	// Without a channel, ipmitool finds the first LAN channel itself.
+	if data, err := opts.run("ipmitool", "lan", "print"); err == nil {
+		b.LAN = parseIPMILanPrint(data)
+	}
+	return b, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetBMC(t *testing.T) {
+	const dir = "testdata/bmc"
+	tools := fakeRunner(map[string]fakeCommand{
+		"ipmitool mc info":   {output: readTestFile(t, dir+"/ipmitool-mc-info.txt")},
+		"ipmitool lan print": {output: readTestFile(t, dir+"/ipmitool-lan-print.txt")},
+	})
+	noBMC := fakeRunner(map[string]fakeCommand{
+		"ipmitool mc info": {err: exitError(t, 1,
+			"Could not open device at /dev/ipmi0 or /dev/ipmi/0 or /dev/ipmidev/0: No such file or directory\n")},
+		"ipmitool lan print": {err: exitError(t, 1, "Error: Unable to establish IPMI v2 / RMCP+ session\n")},
+	})
+	// The driver loaded without finding a BMC; git can't keep the empty
+	// class directory in testdata.
+	unloaded := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(unloaded, "sys", "class", "ipmi"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		root        string
+		devicePaths []string
+		opts        collectOptions
+		want        *bmc
+	}{
+		{
+			name:        "device",
+			root:        "testdata/sysfs",
+			devicePaths: []string{dir + "/dev/ipmi/0", dir + "/dev/ipmi0"},
+			opts:        collectOptions{run: fakeRunner(nil)},
+			want:        &bmc{Device: dir + "/dev/ipmi0"},
+		},
+		{
+			name:        "ipmitool",
+			root:        "testdata/sysfs",
+			devicePaths: []string{dir + "/dev/ipmi0"},
+			opts:        collectOptions{bmc: true, run: tools},
+			want: &bmc{
+				Device:          dir + "/dev/ipmi0",
+				IPMIVersion:     "2.0",
+				FirmwareVersion: "3.88",
+				Manufacturer:    "Super Micro Computer Inc.",
+				ManufacturerID:  uint64Ptr(10876),
+				ProductID:       uint64Ptr(2167),
+				LAN: &bmcLAN{
+					AddressSource:  "DHCP Address",
+					IPAddress:      "10.20.30.40",
+					SubnetMask:     "255.255.255.0",
+					MACAddress:     "0c:c4:7a:11:22:33",
+					DefaultGateway: "10.20.30.1",
+				},
+			},
+		},
+		{
+			// The driver is loaded but there's no device node for
+			// ipmitool to use.
+			name:        "sysfs only",
+			root:        dir,
+			devicePaths: []string{dir + "/dev/ipmi/0"},
+			opts:        collectOptions{bmc: true, run: noBMC},
+			want:        &bmc{},
+		},
+		{
+			name:        "empty class",
+			root:        unloaded,
+			devicePaths: []string{dir + "/dev/ipmi/0"},
+			opts:        collectOptions{bmc: true, run: noBMC},
+		},
+		{
+			name:        "none",
+			root:        "testdata/sysfs",
+			devicePaths: []string{dir + "/dev/ipmi/0"},
+			opts:        collectOptions{bmc: true, run: tools},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useRoots(t, test.root)
+			b, err := getBMC(test.devicePaths, &test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(b, test.want) {
+				t.Errorf("getBMC() =\n%+v\nwant\n%+v", b, test.want)
+			}
+		})
+	}
+}
+
+func TestParseIPMIFields(t *testing.T) {
+	fields := parseIPMIFields(readTestFile(t, "testdata/bmc/ipmitool-lan-print.txt"))
+	// Continuation lines don't replace the field they belong to.
+	if got := fields["Auth Type Enable"]; got != "Callback : MD2 MD5 PASSWORD" {
+		t.Errorf("Auth Type Enable = %q", got)
+	}
+	if got := fields["Cipher Suite Priv Max"]; got != "XaaaXXaaaXXaaXX" {
+		t.Errorf("Cipher Suite Priv Max = %q", got)
+	}
+	if _, ok := fields[""]; ok {
+		t.Errorf("continuation lines parsed as fields: %q", fields[""])
+	}
+}
+
+func TestParseIPMIID(t *testing.T) {
+	tests := []struct {
+		value string
+		want  *uint64
+	}{
+		{value: "10876", want: uint64Ptr(10876)},
+		{value: "2167 (0x0877)", want: uint64Ptr(2167)},
+		{value: "0x0877"},
+		{value: ""},
+	}
+	for _, test := range tests {
+		if got := parseIPMIID(test.value); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseIPMIID(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestParseIPMILanPrintNoAddress(t *testing.T) {
+	if lan := parseIPMILanPrint([]byte("Set in Progress : Set Complete\n")); lan != nil {
+		t.Errorf("parseIPMILanPrint() = %+v, want nil", lan)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// boot is the current boot of the machine. BootTime is in RFC 3339 format,
+// in UTC, and BootID is the random ID the kernel generates on every boot.
+type boot struct {
+	BootTime      string  `json:"boot_time" yaml:"boot_time"`
+	UptimeSeconds float64 `json:"uptime_seconds" yaml:"uptime_seconds"`
+	BootID        string  `json:"boot_id,omitempty" yaml:"boot_id,omitempty"`
+}
+
+// parseBootTime returns the btime line of /proc/stat, which is when the
+// machine booted in seconds since the epoch.
+func parseBootTime(data []byte) (time.Time, error) {
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[0] != "btime" {
+			continue
+		}
+		seconds, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid btime %q", fields[1])
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("no btime in /proc/stat")
+}
+
+// parseUptime returns the first field of /proc/uptime, which is how long
+// the machine has been up; the second is how long it's been idle.
+func parseUptime(data []byte) (float64, error) {
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty /proc/uptime")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// getBoot reads when the machine booted and the ID of the boot.
+func getBoot() (*boot, error) {
+	data, err := ioutil.ReadFile(procPath("stat"))
+	if err != nil {
+		return nil, err
+	}
+	bootTime, err := parseBootTime(data)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = ioutil.ReadFile(procPath("uptime")); err != nil {
+		return nil, err
+	}
+	uptime, err := parseUptime(data)
+	if err != nil {
+		return nil, err
+	}
+	b := &boot{BootTime: bootTime.Format(time.RFC3339), UptimeSeconds: uptime}
+	b.BootID, _ = readString(procPath("sys/kernel/random/boot_id"))
+	return b, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetBoot(t *testing.T) {
+	useRoots(t, "testdata/boot")
+	b, err := getBoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := boot{
+		BootTime:      "2025-10-14T00:00:00Z",
+		UptimeSeconds: 350735.47,
+		BootID:        "6b1c2f7e-3a4d-4b8e-9f01-2c3d4e5f6a7b",
+	}
+	if *b != want {
+		t.Errorf("getBoot() = %+v, want %+v", *b, want)
+	}
+}
+
+func TestGetBootNoStat(t *testing.T) {
+	useRoots(t, "testdata/boot-nostat")
+	if b, err := getBoot(); err == nil {
+		t.Errorf("getBoot() = %+v without /proc/stat, want an error", b)
+	}
+}
+
+func TestParseBootTime(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    time.Time
+		wantErr string
+	}{
+		{data: "ctxt 1990473\nbtime 1760400000\n", want: time.Unix(1760400000, 0).UTC()},
+		// Other lines starting with btime don't count.
+		{data: "btime_extra 1 2\nbtime 0\n", want: time.Unix(0, 0).UTC()},
+		{data: "btime soon\n", wantErr: `invalid btime "soon"`},
+		{data: "ctxt 1990473\n", wantErr: "no btime in /proc/stat"},
+	}
+	for _, test := range tests {
+		got, err := parseBootTime([]byte(test.data))
+		if test.wantErr != "" {
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("parseBootTime(%q) error = %v, want %q", test.data, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseBootTime(%q): %v", test.data, err)
+		} else if !got.Equal(test.want) || got.Location() != time.UTC {
+			t.Errorf("parseBootTime(%q) = %v, want %v", test.data, got, test.want)
+		}
+	}
+}
+
+func TestParseUptime(t *testing.T) {
+	if uptime, err := parseUptime([]byte("12.03 20.80\n")); err != nil || uptime != 12.03 {
+		t.Errorf("parseUptime() = %v, %v; want 12.03", uptime, err)
+	}
+	for _, data := range []string{"", "\n", "up 20.80"} {
+		if uptime, err := parseUptime([]byte(data)); err == nil {
+			t.Errorf("parseUptime(%q) = %v, want an error", data, uptime)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultCachePath is where --cache keeps the last collection.
+const defaultCachePath = "/run/maas/machine-resources.cache"
+
+// resultCache stores collected resources for reuse by later runs within
+// ttl. now is the clock used for timestamps and expiry.
+type resultCache struct {
+	path string
+	ttl  time.Duration
+	now  func() time.Time
+}
+
+// cacheEntry is what's written to the cache file. Key identifies what was
+// collected, so that a run collecting something else doesn't reuse it.
+// Fingerprint is that of the resources before they were redacted.
+type cacheEntry struct {
+	Timestamp   time.Time         `json:"timestamp"`
+	Key         string            `json:"key"`
+	Fingerprint string            `json:"fingerprint"`
+	Resources   *machineResources `json:"resources"`
+}
+
+// cacheKey describes the subsystems and options a collection used, the
+// sysfs and procfs roots it read, and the salt it was redacted with, if rd
+// isn't nil. The salt itself isn't written to the cache, only a hash of it.
+func cacheKey(selected []subsystem, opts *collectOptions, rd *redactor) string {
+	names := make([]string, len(selected))
+	for i, s := range selected {
+		names[i] = s.name
+	}
+	var redaction string
+	if rd != nil {
+		redaction = rd.hash("cache-key")
+	}
+	return fmt.Sprintf(
+		"%s smart=%t dimms=%t gpu-extended=%t sensors=%t hardware-raid=%t bmc=%t plugin-dir=%q sysfs-root=%q proc-root=%q redact=%q",
+		strings.Join(names, ","), opts.smart, opts.dimms, opts.gpuExtended,
+		opts.sensors, opts.hardwareRAID, opts.bmc, opts.pluginDir,
+		sysfsRoot, procRoot, redaction)
+}
+
+// load returns the cached resources for key and their fingerprint, if there
+// are any that haven't expired.
+func (c *resultCache) load(key string) (*machineResources, string, bool) {
+	data, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		return nil, "", false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, "", false
+	}
+	if entry.Key != key || entry.Resources == nil || entry.Fingerprint == "" {
+		return nil, "", false
+	}
+	age := c.now().Sub(entry.Timestamp)
+	if age < 0 || age > c.ttl {
+		return nil, "", false
+	}
+	return entry.Resources, entry.Fingerprint, true
+}
+
+// store caches r and its fingerprint as the resources for key.
+func (c *resultCache) store(key string, r *machineResources, fingerprint string) error {
+	data, err := json.Marshal(cacheEntry{
+		Timestamp:   c.now(),
+		Key:         key,
+		Fingerprint: fingerprint,
+		Resources:   r,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	return writeFile(c.path, data)
+}
+
+// collection is the outcome of cachedCollection. complete reports whether
+// all core subsystems were collected, and storeErr why the collection
+// couldn't be cached, if it couldn't.
+type collection struct {
+	resources   *machineResources
+	fingerprint string
+	cached      bool
+	complete    bool
+	storeErr    error
+}
+
+// cachedCollection returns the resources for the selected subsystems from
+// cache if reuse is set and it has them, and otherwise collects them; cache
+// is nil for no caching. The fingerprint is taken before redacting with rd,
+// if it isn't nil, so that it stays the same from one run to the next even
+// with a random salt. Only redacted resources are cached, so that --redact
+// never leaves identifiers in the cache file.
+func cachedCollection(
+	ctx context.Context, selected []subsystem, opts *collectOptions,
+	cache *resultCache, reuse bool, rd *redactor,
+) (*collection, error) {
+	key := cacheKey(selected, opts, rd)
+	if cache != nil && reuse {
+		r, fingerprint, hit := cache.load(key)
+		if opts.logger != nil {
+			opts.logger.Debug("cache lookup", "path", cache.path, "hit", hit)
+		}
+		if hit {
+			return &collection{resources: r, fingerprint: fingerprint, cached: true, complete: true}, nil
+		}
+	}
+	r, complete, err := collectResources(ctx, selected, opts)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := canonicalFingerprint(r)
+	if err != nil {
+		return nil, err
+	}
+	c := &collection{resources: r, fingerprint: hex.EncodeToString(sum[:]), complete: complete}
+	if rd != nil {
+		rd.redact(r)
+	}
+	// Only cache a clean collection, so that a transient failure isn't
+	// kept around.
+	if cache != nil && len(r.Errors) == 0 {
+		c.storeErr = cache.store(key, r, c.fingerprint)
+	}
+	return c, nil
+}
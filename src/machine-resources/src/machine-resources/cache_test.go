@@ -0,0 +1,169 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResultCache(t *testing.T) {
+	stored := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		key  string
+		age  time.Duration
+		hit  bool
+	}{
+		{"hit", "cpu,memory", time.Minute, true},
+		{"hit at ttl", "cpu,memory", 5 * time.Minute, true},
+		{"expired", "cpu,memory", 5*time.Minute + time.Second, false},
+		{"from the future", "cpu,memory", -time.Minute, false},
+		{"other key", "cpu", time.Minute, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now := stored
+			cache := &resultCache{
+				path: filepath.Join(t.TempDir(), "maas", "machine-resources.cache"),
+				ttl:  5 * time.Minute,
+				now:  func() time.Time { return now },
+			}
+			r := &machineResources{Virt: &virtualization{Type: virtBareMetal}}
+			if err := cache.store("cpu,memory", r, "0123abcd"); err != nil {
+				t.Fatal(err)
+			}
+			now = stored.Add(test.age)
+			got, fingerprint, hit := cache.load(test.key)
+			if hit != test.hit {
+				t.Fatalf("load() hit = %t, want %t", hit, test.hit)
+			}
+			if hit && (got.Virt == nil || got.Virt.Type != virtBareMetal || fingerprint != "0123abcd") {
+				t.Errorf("load() = %+v, want the stored resources", got)
+			}
+		})
+	}
+}
+
+func TestResultCacheMissing(t *testing.T) {
+	cache := &resultCache{
+		path: filepath.Join(t.TempDir(), "missing.cache"),
+		ttl:  time.Hour,
+		now:  time.Now,
+	}
+	if _, _, hit := cache.load("cpu"); hit {
+		t.Error("load() hit without a cache file")
+	}
+}
+
+// A collection of a fixture tree mustn't be reused for the real machine,
+// nor the other way around.
+func TestCacheKeyRoots(t *testing.T) {
+	selected := subsystems[:2]
+	opts := &collectOptions{}
+	live := cacheKey(selected, opts, nil)
+	useRoots(t, "testdata/virt/kvm")
+	if fixture := cacheKey(selected, opts, nil); fixture == live {
+		t.Errorf("cacheKey() = %q for both the real and the fixture roots", live)
+	}
+}
+
+func TestCacheKeyOptions(t *testing.T) {
+	base := cacheKey(subsystems, &collectOptions{}, nil)
+	for name, opts := range map[string]*collectOptions{
+		"smart":      {smart: true},
+		"dimms":      {dimms: true},
+		"plugin-dir": {pluginDir: "/etc/maas/plugins"},
+	} {
+		if cacheKey(subsystems, opts, nil) == base {
+			t.Errorf("cacheKey() ignores %s", name)
+		}
+	}
+	if cacheKey(subsystems[:1], &collectOptions{}, nil) == base {
+		t.Error("cacheKey() ignores the selected subsystems")
+	}
+}
+
+func TestCacheKeyRedaction(t *testing.T) {
+	salted, err := newRedactor("salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := newRedactor("pepper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &collectOptions{}
+	keys := map[string]string{
+		"unredacted": cacheKey(subsystems, opts, nil),
+		"salt":       cacheKey(subsystems, opts, salted),
+		"pepper":     cacheKey(subsystems, opts, other),
+	}
+	seen := make(map[string]string)
+	for name, key := range keys {
+		if strings.Contains(key, "salt") || strings.Contains(key, "pepper") {
+			t.Errorf("%s cache key %q gives the salt away", name, key)
+		}
+		if previous, ok := seen[key]; ok {
+			t.Errorf("%s and %s share the cache key %q", name, previous, key)
+		}
+		seen[key] = name
+	}
+}
+
+func TestCachedCollectionRedacted(t *testing.T) {
+	raw, identifying := redactionTestResources()
+	selected := []subsystem{{"storage", false, func(r *machineResources, opts *collectOptions) error {
+		// A fresh copy, since redacting changes it in place.
+		fresh, _ := redactionTestResources()
+		r.Storage = fresh.Storage
+		return nil
+	}}}
+	want, err := canonicalFingerprint(&machineResources{Storage: raw.Storage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd, err := newRedactor("salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := &resultCache{
+		path: filepath.Join(t.TempDir(), "machine-resources.cache"),
+		ttl:  time.Hour,
+		now:  time.Now,
+	}
+	first, err := cachedCollection(context.Background(), selected, &collectOptions{}, cache, true, rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.cached || first.storeErr != nil {
+		t.Fatalf("first run cached = %t, storeErr = %v", first.cached, first.storeErr)
+	}
+	data := readTestFile(t, cache.path)
+	for _, id := range identifying {
+		if strings.Contains(string(data), id) {
+			t.Errorf("%q is in the cache file of a redacted run", id)
+		}
+	}
+	second, err := cachedCollection(context.Background(), selected, &collectOptions{}, cache, true, rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.cached {
+		t.Fatal("second run with the same salt didn't use the cache")
+	}
+	if !reflect.DeepEqual(second.resources, first.resources) {
+		t.Errorf("cached resources =\n%+v\nwant the redacted\n%+v", second.resources, first.resources)
+	}
+	// The fingerprint is of the hardware, not of its redacted report.
+	wantHex := hex.EncodeToString(want[:])
+	if first.fingerprint != wantHex || second.fingerprint != wantHex {
+		t.Errorf("fingerprints = %s, %s; want %s", first.fingerprint, second.fingerprint, wantHex)
+	}
+}
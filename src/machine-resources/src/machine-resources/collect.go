@@ -0,0 +1,392 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// machineResources is the report emitted by machine-resources. Subsystems
+// that could not be collected are left out and their failure is recorded in
+// Errors, keyed by subsystem or group name; see errorKey. RequiresRoot lists the subsystems and
+// fields that were incomplete for lack of permission. Timings are only set
+// by --profile, and Architecture and UnsupportedSubsystems by --arch-report.
+type machineResources struct {
+	Architecture          string                  `json:"architecture,omitempty" yaml:"architecture,omitempty"`
+	UnsupportedSubsystems []string                `json:"unsupported_subsystems,omitempty" yaml:"unsupported_subsystems,omitempty"`
+	CPU                   *cpu                    `json:"cpu,omitempty" yaml:"cpu,omitempty"`
+	Memory                *memory                 `json:"memory,omitempty" yaml:"memory,omitempty"`
+	GPU                   *gpu                    `json:"gpu,omitempty" yaml:"gpu,omitempty"`
+	Network               *network                `json:"network,omitempty" yaml:"network,omitempty"`
+	Infiniband            []infinibandDevice      `json:"infiniband,omitempty" yaml:"infiniband,omitempty"`
+	Storage               *storage                `json:"storage,omitempty" yaml:"storage,omitempty"`
+	RAID                  *raid                   `json:"raid,omitempty" yaml:"raid,omitempty"`
+	USB                   *usb                    `json:"usb,omitempty" yaml:"usb,omitempty"`
+	PCI                   *pci                    `json:"pci,omitempty" yaml:"pci,omitempty"`
+	DMI                   *dmiInfo                `json:"dmi,omitempty" yaml:"dmi,omitempty"`
+	Identifiers           *identifiers            `json:"identifiers,omitempty" yaml:"identifiers,omitempty"`
+	NUMA                  []numaNode              `json:"numa,omitempty" yaml:"numa,omitempty"`
+	Virt                  *virtualization         `json:"virtualization,omitempty" yaml:"virtualization,omitempty"`
+	SystemSoftware        *systemSoftware         `json:"system_software,omitempty" yaml:"system_software,omitempty"`
+	Boot                  *boot                   `json:"boot,omitempty" yaml:"boot,omitempty"`
+	Firmware              *firmware               `json:"firmware,omitempty" yaml:"firmware,omitempty"`
+	BMC                   *bmc                    `json:"bmc,omitempty" yaml:"bmc,omitempty"`
+	Power                 []powerSupply           `json:"power,omitempty" yaml:"power,omitempty"`
+	Sensors               []sensorReading         `json:"sensors,omitempty" yaml:"sensors,omitempty"`
+	Plugins               map[string]pluginOutput `json:"plugins,omitempty" yaml:"plugins,omitempty"`
+	RequiresRoot          []string                `json:"requires_root,omitempty" yaml:"requires_root,omitempty"`
+	Timings               map[string]float64      `json:"_timings,omitempty" yaml:"_timings,omitempty"`
+	Errors                map[string]string       `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// collectOptions enables the optional parts of collection, which are slower
+// or need root.
+type collectOptions struct {
+	// smart adds SMART health data from smartctl to each disk.
+	smart bool
+	// dimms adds the memory modules reported by dmidecode.
+	dimms bool
+	// gpuExtended adds driver details from sysfs and nvidia-smi to GPUs.
+	gpuExtended bool
+	// sensors adds hwmon temperature and fan readings.
+	sensors bool
+	// hardwareRAID adds logical volumes reported by storcli or megacli.
+	hardwareRAID bool
+	// bmc adds BMC firmware and LAN details from ipmitool.
+	bmc bool
+	// pluginDir, if set, is a directory of executables whose JSON output
+	// is added to the report.
+	pluginDir string
+	// run runs the external tools some collectors use.
+	run commandRunner
+	// logger gets debug logs of each subsystem's collection and the
+	// retries of failed ones. slog.Default() is used if it's nil.
+	logger *slog.Logger
+	// collected, if not nil, is called after each subsystem with the
+	// resources so far and the subsystem's error, if it failed. It isn't
+	// called once the collection's context is done.
+	collected func(name string, r *machineResources, err error)
+	// timings, if not nil, gets how long each subsystem took, retries
+	// included.
+	timings map[string]time.Duration
+	// retries is how many more times a failed subsystem is tried, waiting
+	// retryDelay before each attempt.
+	retries    int
+	retryDelay time.Duration
+}
+
+// subsystem is one independently collected part of the report.
+type subsystem struct {
+	name string
+	// core subsystems must succeed for the report to be usable.
+	core    bool
+	collect func(*machineResources, *collectOptions) error
+}
+
+// subsystems lists everything collected, in output order. The vendored LXD
+// resources package doesn't expose USB, PCI or system information yet, so
+// everything after storage is collected by our own code.
+var subsystems = []subsystem{
+	{"cpu", true, func(r *machineResources, opts *collectOptions) (err error) {
+		r.CPU, err = getCPU()
+		return err
+	}},
+	{"memory", true, func(r *machineResources, opts *collectOptions) (err error) {
+		r.Memory, err = getMemory(opts)
+		return err
+	}},
+	{"gpu", false, func(r *machineResources, opts *collectOptions) (err error) {
+		r.GPU, err = getGPU(opts)
+		return err
+	}},
+	{"network", false, func(r *machineResources, opts *collectOptions) (err error) {
+		r.Network, err = getNetwork(opts)
+		return err
+	}},
+	{"infiniband", false, func(r *machineResources, opts *collectOptions) (err error) {
+		r.Infiniband, err = getInfiniband()
+		return err
+	}},
+	{"storage", false, func(r *machineResources, opts *collectOptions) (err error) {
+		r.Storage, err = getStorage(opts)
+		return err
+	}},
+	{"raid", false, func(r *machineResources, opts *collectOptions) (err error) {
+		r.RAID, err = getRAID(opts)
+		return err
+	}},
+	{"usb", false, func(r *machineResources, opts *collectOptions) (err error) {
+		r.USB, err = getUSB(usbIDsPaths)
+		return err
+	}},
+	{"pci", false, func(r *machineResources, opts *collectOptions) (err error) {
+		r.PCI, err = getPCI(modulesPath)
+		return err
+	}},
+	{"dmi", false, func(r *machineResources, opts *collectOptions) (err error) {
+		r.DMI, err = getDMI(sysfsPath(dmiPath), r.permissionDenied("dmi"))
+		return err
+	}},
+	{"identifiers", false, func(r *machineResources, opts *collectOptions) (err error) {
+		r.Identifiers, err = getIdentifiers(
+			machineIDPaths, sysfsPath(dmiPath), r.permissionDenied("identifiers"))
+		return err
+	}},
+	{"numa", false, func(r *machineResources, opts *collectOptions) (err error) {
+		r.NUMA, err = getNUMA()
+		return err
+	}},
+	{"virtualization", false, func(r *machineResources, opts *collectOptions) (err error) {
+		r.Virt, err = getVirtualization("/")
+		return err
+	}},
+	{"system_software", false, func(r *machineResources, opts *collectOptions) (err error) {
+		r.SystemSoftware, err = getSystemSoftware(osReleasePaths)
+		return err
+	}},
+	{"boot", false, func(r *machineResources, opts *collectOptions) (err error) {
+		r.Boot, err = getBoot()
+		return err
+	}},
+	{"firmware", false, func(r *machineResources, opts *collectOptions) (err error) {
+		r.Firmware, err = getFirmware()
+		return err
+	}},
+	{"bmc", false, func(r *machineResources, opts *collectOptions) (err error) {
+		r.BMC, err = getBMC(ipmiDevicePaths, opts)
+		return err
+	}},
+	{"power", false, func(r *machineResources, opts *collectOptions) (err error) {
+		r.Power, err = getPowerSupplies()
+		return err
+	}},
+	{"sensors", false, func(r *machineResources, opts *collectOptions) (err error) {
+		if opts.sensors {
+			r.Sensors, err = getSensors()
+		}
+		return err
+	}},
+	// A failed plugin is reported under its own name, without failing the
+	// others.
+	{"plugins", false, func(r *machineResources, opts *collectOptions) error {
+		if opts.pluginDir == "" {
+			return nil
+		}
+		outputs, failures, err := getPlugins(opts.pluginDir, pluginTimeout)
+		if err != nil {
+			return err
+		}
+		r.Plugins = outputs
+		for name, failure := range failures {
+			if r.Errors == nil {
+				r.Errors = make(map[string]string)
+			}
+			r.Errors["plugins."+name] = failure.Error()
+		}
+		return nil
+	}},
+}
+
+// subsystemGroups maps names that stand for several subsystems to them, in
+// collection order. The system group covers the sections describing the
+// machine as a whole rather than a kind of device.
+var subsystemGroups = map[string][]string{
+	"system": {"dmi", "identifiers", "system_software"},
+}
+
+// errorKey returns the key a failure of the named subsystem is recorded
+// under in machineResources.Errors: that of its group, if it's in one, so
+// that the key is the name the subsystem was selected by.
+func errorKey(name string) string {
+	for group, members := range subsystemGroups {
+		for _, member := range members {
+			if member == name {
+				return group
+			}
+		}
+	}
+	return name
+}
+
+// selectSubsystems returns the subsystems to collect given the names passed
+// to --include and --exclude, at most one of which may be non-empty. Either
+// may name a group from subsystemGroups.
+func selectSubsystems(include, exclude []string) ([]subsystem, error) {
+	if len(include) > 0 && len(exclude) > 0 {
+		return nil, fmt.Errorf("--include and --exclude are mutually exclusive")
+	}
+	known := make(map[string]bool, len(subsystems))
+	names := make([]string, 0, len(subsystems)+len(subsystemGroups))
+	for _, s := range subsystems {
+		known[s.name] = true
+		names = append(names, s.name)
+	}
+	groups := make([]string, 0, len(subsystemGroups))
+	for group := range subsystemGroups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	names = append(names, groups...)
+	listed := make(map[string]bool)
+	for _, name := range append(include, exclude...) {
+		if members, ok := subsystemGroups[name]; ok {
+			for _, member := range members {
+				listed[member] = true
+			}
+			continue
+		}
+		if !known[name] {
+			return nil, fmt.Errorf(
+				"unknown subsystem %q (expected one of: %s)",
+				name, strings.Join(names, ", "))
+		}
+		listed[name] = true
+	}
+	if len(include) == 0 && len(exclude) == 0 {
+		return subsystems, nil
+	}
+	var selected []subsystem
+	for _, s := range subsystems {
+		// Included subsystems are listed; excluded ones are not.
+		if listed[s.name] == (len(include) > 0) {
+			selected = append(selected, s)
+		}
+	}
+	return selected, nil
+}
+
+// collectSubsystem runs a single collector, turning a panic into an error so
+// that one misbehaving probe can't take the rest of the report down with it.
+func collectSubsystem(s subsystem, r *machineResources, opts *collectOptions) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return s.collect(r, opts)
+}
+
+// retry calls fn until it succeeds, at most retries more times after the
+// first failure and waiting delay before each retry. It gives up early if ctx
+// is done, returning the last error. onRetry, if not nil, is called before
+// each retry with the attempt number and the error that caused it.
+func retry(ctx context.Context, retries int, delay time.Duration, onRetry func(int, error), fn func() error) error {
+	err := fn()
+	for attempt := 1; err != nil && attempt <= retries; attempt++ {
+		if onRetry != nil {
+			onRetry(attempt, err)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		err = fn()
+	}
+	return err
+}
+
+// collectResources collects the given subsystems, recording failures rather
+// than stopping at the first one. The returned bool reports whether all core
+// subsystems were collected. Collection stops early, with ctx's error, once
+// ctx is done.
+func collectResources(ctx context.Context, selected []subsystem, opts *collectOptions) (*machineResources, bool, error) {
+	type result struct {
+		r  *machineResources
+		ok bool
+	}
+	// Buffered so the collecting goroutine can always finish and exit, even
+	// once nobody is waiting for it any more.
+	done := make(chan result, 1)
+	go func() {
+		r, ok := collectSubsystems(ctx, selected, opts)
+		done <- result{r, ok}
+	}()
+	select {
+	case res := <-done:
+		return res.r, res.ok, nil
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+func collectSubsystems(ctx context.Context, selected []subsystem, opts *collectOptions) (*machineResources, bool) {
+	logger := opts.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	r := &machineResources{}
+	ok := true
+	for _, s := range selected {
+		if ctx.Err() != nil {
+			return r, false
+		}
+		// Retries are logged at error level so that, as before --log-level,
+		// they're on stderr by default.
+		onRetry := func(attempt int, err error) {
+			logger.Error(
+				"retrying", "subsystem", s.name, "delay", opts.retryDelay,
+				"attempt", attempt, "retries", opts.retries, "error", err)
+		}
+		// Tools that were denied permission mark the whole subsystem as
+		// needing root, since we can't tell which fields they'd have
+		// filled in.
+		subsystemOpts := *opts
+		if opts.run != nil {
+			subsystemOpts.run = func(name string, args ...string) ([]byte, error) {
+				out, err := opts.run(name, args...)
+				if err != nil && deniedPermission(out, err) {
+					r.requireRoot(s.name)
+				}
+				return out, err
+			}
+		}
+		logger.Debug("collecting", "subsystem", s.name)
+		start := time.Now()
+		err := retry(ctx, opts.retries, opts.retryDelay, onRetry, func() error {
+			return collectSubsystem(s, r, &subsystemOpts)
+		})
+		elapsed := time.Since(start)
+		if opts.timings != nil {
+			opts.timings[s.name] = elapsed
+		}
+		if err == nil {
+			logger.Debug("collected", "subsystem", s.name, "duration", elapsed)
+		} else {
+			logger.Debug(
+				"collection failed", "subsystem", s.name,
+				"duration", elapsed, "error", err)
+			if r.Errors == nil {
+				r.Errors = make(map[string]string)
+			}
+			// Failures within a group are all recorded under its
+			// name, each saying which subsystem it's from.
+			key, msg := errorKey(s.name), err.Error()
+			if key != s.name {
+				msg = s.name + ": " + msg
+				if previous, failed := r.Errors[key]; failed {
+					msg = previous + "; " + msg
+				}
+			}
+			r.Errors[key] = msg
+			if deniedPermission(nil, err) {
+				r.requireRoot(s.name)
+			}
+			if s.core {
+				ok = false
+			}
+		}
+		// Once ctx is done collectResources has returned, so there's
+		// nobody left to hear about this subsystem.
+		if opts.collected != nil && ctx.Err() == nil {
+			opts.collected(s.name, r, err)
+		}
+	}
+	return r, ok
+}
@@ -0,0 +1,306 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectSubsystemsPartial(t *testing.T) {
+	tests := []struct {
+		name     string
+		core     bool
+		broken   func() error
+		wantOK   bool
+		wantErrs map[string]string
+	}{
+		{
+			name:     "optional failure",
+			broken:   func() error { return errors.New("no such device") },
+			wantOK:   true,
+			wantErrs: map[string]string{"broken": "no such device"},
+		},
+		{
+			name:     "core failure",
+			core:     true,
+			broken:   func() error { return errors.New("no such device") },
+			wantOK:   false,
+			wantErrs: map[string]string{"broken": "no such device"},
+		},
+		{
+			name:     "panic",
+			broken:   func() error { panic("index out of range") },
+			wantOK:   true,
+			wantErrs: map[string]string{"broken": "panic: index out of range"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected := []subsystem{
+				{"broken", test.core, func(r *machineResources, opts *collectOptions) error {
+					return test.broken()
+				}},
+				{"virtualization", false, func(r *machineResources, opts *collectOptions) error {
+					r.Virt = &virtualization{Type: virtBareMetal}
+					return nil
+				}},
+			}
+			r, ok := collectSubsystems(context.Background(), selected, &collectOptions{})
+			if ok != test.wantOK {
+				t.Errorf("ok = %t, want %t", ok, test.wantOK)
+			}
+			if len(r.Errors) != len(test.wantErrs) || r.Errors["broken"] != test.wantErrs["broken"] {
+				t.Errorf("errors = %v, want %v", r.Errors, test.wantErrs)
+			}
+			if r.Virt == nil {
+				t.Error("the subsystem after the failure wasn't collected")
+			}
+		})
+	}
+}
+
+func TestCollectSubsystemsGroupErrors(t *testing.T) {
+	selected := []subsystem{
+		{"cpu", true, func(r *machineResources, opts *collectOptions) error {
+			return nil
+		}},
+		{"dmi", false, func(r *machineResources, opts *collectOptions) error {
+			return errors.New("no DMI table")
+		}},
+		{"identifiers", false, func(r *machineResources, opts *collectOptions) error {
+			panic("nil map")
+		}},
+		{"system_software", false, func(r *machineResources, opts *collectOptions) error {
+			r.SystemSoftware = &systemSoftware{KernelRelease: "5.15.0-91-generic"}
+			return nil
+		}},
+		{"gpu", false, func(r *machineResources, opts *collectOptions) error {
+			return errors.New("no GPUs")
+		}},
+	}
+	r, ok := collectSubsystems(context.Background(), selected, &collectOptions{})
+	if !ok {
+		t.Error("collectSubsystems() failed, though no core subsystem did")
+	}
+	// The system sections are keyed by the name they're selected by, as
+	// ungrouped subsystems are.
+	want := map[string]string{
+		"system": "dmi: no DMI table; identifiers: panic: nil map",
+		"gpu":    "no GPUs",
+	}
+	if !reflect.DeepEqual(r.Errors, want) {
+		t.Errorf("errors = %v, want %v", r.Errors, want)
+	}
+	if r.SystemSoftware == nil {
+		t.Error("system_software wasn't collected after the rest of its group failed")
+	}
+}
+
+func TestErrorKey(t *testing.T) {
+	for name, want := range map[string]string{
+		"dmi":             "system",
+		"identifiers":     "system",
+		"system_software": "system",
+		"cpu":             "cpu",
+		"plugins":         "plugins",
+	} {
+		if got := errorKey(name); got != want {
+			t.Errorf("errorKey(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCollectResourcesTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	selected := []subsystem{{"hung", false, func(r *machineResources, opts *collectOptions) error {
+		<-release
+		return nil
+	}}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	r, _, err := collectResources(ctx, selected, &collectOptions{})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("collectResources() = %v, %v; want %v", r, err, context.DeadlineExceeded)
+	}
+}
+
+// A subsystem that finishes after the timeout mustn't be reported, since
+// main has already given up on the collection by then.
+func TestCollectSubsystemsNotCollectedAfterTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	selected := []subsystem{
+		{"first", false, func(r *machineResources, opts *collectOptions) error { return nil }},
+		{"slow", false, func(r *machineResources, opts *collectOptions) error {
+			cancel()
+			return nil
+		}},
+		{"last", false, func(r *machineResources, opts *collectOptions) error {
+			t.Error("collected a subsystem after the timeout")
+			return nil
+		}},
+	}
+	var collected []string
+	opts := &collectOptions{collected: func(name string, r *machineResources, err error) {
+		collected = append(collected, name)
+	}}
+	if _, ok := collectSubsystems(ctx, selected, opts); ok {
+		t.Error("a timed out collection was reported as complete")
+	}
+	if len(collected) != 1 || collected[0] != "first" {
+		t.Errorf("collected %v, want only [first]", collected)
+	}
+}
+
+func TestSelectSubsystems(t *testing.T) {
+	tests := []struct {
+		name             string
+		include, exclude []string
+		want             []string
+		wantErr          bool
+	}{
+		{name: "include", include: []string{"storage", "cpu"}, want: []string{"cpu", "storage"}},
+		{name: "exclude", exclude: []string{"plugins", "sensors", "power"}, want: []string{
+			"cpu", "memory", "gpu", "network", "infiniband", "storage", "raid",
+			"usb", "pci", "dmi", "identifiers", "numa", "virtualization",
+			"system_software", "boot", "firmware", "bmc"}},
+		// The names the --include and --exclude flags were asked for.
+		{name: "requested", include: []string{
+			"cpu", "memory", "gpu", "network", "storage", "usb", "pci", "system"},
+			want: []string{
+				"cpu", "memory", "gpu", "network", "storage", "usb", "pci",
+				"dmi", "identifiers", "system_software"}},
+		{name: "include group", include: []string{"system"}, want: []string{
+			"dmi", "identifiers", "system_software"}},
+		{name: "group and member", include: []string{"identifiers", "system"}, want: []string{
+			"dmi", "identifiers", "system_software"}},
+		{name: "exclude group", exclude: []string{"system", "plugins"}, want: []string{
+			"cpu", "memory", "gpu", "network", "infiniband", "storage", "raid",
+			"usb", "pci", "numa", "virtualization", "boot", "firmware", "bmc",
+			"power", "sensors"}},
+		{name: "unknown", include: []string{"cpus"}, wantErr: true},
+		{name: "both", include: []string{"cpu"}, exclude: []string{"gpu"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected, err := selectSubsystems(test.include, test.exclude)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("selectSubsystems() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, s := range selected {
+				names = append(names, s.name)
+			}
+			if !reflect.DeepEqual(names, test.want) {
+				t.Errorf("selected %v, want %v", names, test.want)
+			}
+		})
+	}
+}
+
+func TestSelectSubsystemsDefault(t *testing.T) {
+	selected, err := selectSubsystems(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selected) != len(subsystems) {
+		t.Errorf("selected %d subsystems, want all %d", len(selected), len(subsystems))
+	}
+}
+
+// failing returns a function that fails failures times before succeeding,
+// counting its calls in calls.
+func failing(failures int, calls *int) func() error {
+	return func() error {
+		*calls++
+		if *calls <= failures {
+			return errors.New("device busy")
+		}
+		return nil
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name        string
+		retries     int
+		wantErr     bool
+		wantCalls   int
+		wantRetries []int
+	}{
+		{"fail, fail, succeed", 2, false, 3, []int{1, 2}},
+		{"too few retries", 1, true, 2, []int{1}},
+		{"no retries", 0, true, 1, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			var retried []int
+			err := retry(context.Background(), test.retries, time.Millisecond,
+				func(attempt int, err error) { retried = append(retried, attempt) },
+				failing(2, &calls))
+			if (err != nil) != test.wantErr {
+				t.Errorf("retry() = %v, want error %t", err, test.wantErr)
+			}
+			if calls != test.wantCalls {
+				t.Errorf("called %d times, want %d", calls, test.wantCalls)
+			}
+			if !reflect.DeepEqual(retried, test.wantRetries) {
+				t.Errorf("retried attempts %v, want %v", retried, test.wantRetries)
+			}
+		})
+	}
+}
+
+func TestRetryGivesUpWhenDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	start := time.Now()
+	if err := retry(ctx, 5, time.Hour, nil, failing(5, &calls)); err == nil {
+		t.Fatal("retry() succeeded")
+	}
+	if calls != 1 || time.Since(start) > time.Minute {
+		t.Errorf("called %d times over %s once cancelled, want once without waiting", calls, time.Since(start))
+	}
+}
+
+func TestCollectSubsystemsRetries(t *testing.T) {
+	calls := 0
+	fn := failing(2, &calls)
+	selected := []subsystem{{"flaky", true, func(r *machineResources, opts *collectOptions) error {
+		return fn()
+	}}}
+	var logs bytes.Buffer
+	opts := &collectOptions{
+		retries:    2,
+		retryDelay: time.Millisecond,
+		timings:    make(map[string]time.Duration),
+		logger:     slog.New(slog.NewTextHandler(&logs, nil)),
+	}
+	r, ok := collectSubsystems(context.Background(), selected, opts)
+	if !ok || len(r.Errors) != 0 {
+		t.Errorf("collection failed after retrying: %v", r.Errors)
+	}
+	if n := strings.Count(logs.String(), "level=ERROR msg=retrying subsystem=flaky"); n != 2 {
+		t.Errorf("logged %d retries, want 2:\n%s", n, logs.String())
+	}
+	if _, timed := opts.timings["flaky"]; !timed {
+		t.Error("the retried subsystem wasn't timed")
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"os/exec"
+)
+
+// commandRunner runs an external command and returns its standard output.
+// Collectors that shell out take one so that tests can fake the tools.
+type commandRunner func(name string, args ...string) ([]byte, error)
+
+// runCommand is the commandRunner used outside of tests. Output is returned
+// even when the command exits non-zero, since several tools use the exit
+// status to report findings rather than failures.
+func runCommand(name string, args ...string) ([]byte, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(path, args...).Output()
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeCommand is what a fakeRunner returns for one command line.
+type fakeCommand struct {
+	output []byte
+	err    error
+}
+
+// fakeRunner returns a commandRunner that answers commands, keyed by their
+// space-separated command line, with canned results. Any other command
+// fails as if the tool weren't installed.
+func fakeRunner(commands map[string]fakeCommand) commandRunner {
+	return func(name string, args ...string) ([]byte, error) {
+		command, ok := commands[strings.Join(append([]string{name}, args...), " ")]
+		if !ok {
+			return nil, &exec.Error{Name: name, Err: exec.ErrNotFound}
+		}
+		return command.output, command.err
+	}
+}
+
+// readTestFile returns the contents of a fixture file.
+func readTestFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// exitError returns the *exec.ExitError of a command that printed stderr
+// and exited with code, as a real tool's failure would be reported.
+func exitError(t *testing.T, code int, stderr string) error {
+	t.Helper()
+	_, err := exec.Command(
+		"sh", "-c", `printf %s "$1" >&2; exit "$2"`, "sh", stderr, strconv.Itoa(code)).Output()
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Fatalf("sh exited with %v, want exit status %d", err, code)
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressors maps each supported --compress value to a function wrapping a
+// writer in that compressor.
+var compressors = map[string]func(io.Writer) (io.WriteCloser, error){
+	"gzip": func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+	"zstd": func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w)
+	},
+}
+
+func compressorNames() string {
+	names := make([]string, 0, len(compressors))
+	for name := range compressors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// compress returns data compressed with the named compressor. The
+// compressor is closed before returning, which flushes everything it
+// buffered.
+func compress(name string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := compressors[name](&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressors are the magic numbers the output of each compressor starts
+// with, and functions to decompress it.
+var decompressors = []struct {
+	magic      []byte
+	decompress func([]byte) ([]byte, error)
+}{
+	{[]byte{0x1f, 0x8b}, func(data []byte) ([]byte, error) {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(r)
+	}},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, func(data []byte) ([]byte, error) {
+		d, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer d.Close()
+		return d.DecodeAll(data, nil)
+	}},
+}
+
+// decompress returns data decompressed if it's the output of one of the
+// compressors, and as it is otherwise.
+func decompress(data []byte) ([]byte, error) {
+	for _, d := range decompressors {
+		if bytes.HasPrefix(data, d.magic) {
+			return d.decompress(data)
+		}
+	}
+	return data, nil
+}
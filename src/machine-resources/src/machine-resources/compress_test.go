@@ -0,0 +1,81 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCompress(t *testing.T) {
+	tests := []struct {
+		name   string
+		magic  []byte
+		reader func(io.Reader) (io.Reader, error)
+	}{
+		{
+			name:  "gzip",
+			magic: []byte{0x1f, 0x8b},
+			reader: func(r io.Reader) (io.Reader, error) {
+				return gzip.NewReader(r)
+			},
+		},
+		{
+			name:  "zstd",
+			magic: []byte{0x28, 0xb5, 0x2f, 0xfd},
+			reader: func(r io.Reader) (io.Reader, error) {
+				return zstd.NewReader(r)
+			},
+		},
+	}
+	report := bytes.Repeat([]byte(`{"numa":[{"node_id":0,"cpus":[0,1,2,3]}]}`+"\n"), 100)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := compress(test.name, report)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The standard tools recognise the output by its magic
+			// number.
+			if !bytes.HasPrefix(data, test.magic) {
+				t.Errorf("compressed data starts % x, want % x", data[:len(test.magic)], test.magic)
+			}
+			if len(data) >= len(report) {
+				t.Errorf("compressed %d bytes to %d", len(report), len(data))
+			}
+			r, err := test.reader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, report) {
+				t.Errorf("decompressed %q, want %q", got, report)
+			}
+			if got, err := decompress(data); err != nil || !bytes.Equal(got, report) {
+				t.Errorf("decompress() = %q, %v; want %q", got, err, report)
+			}
+		})
+	}
+}
+
+func TestDecompressUncompressed(t *testing.T) {
+	report := []byte(`{"numa":[{"node_id":0,"cpus":[0,1,2,3]}]}` + "\n")
+	if got, err := decompress(report); err != nil || !bytes.Equal(got, report) {
+		t.Errorf("decompress() = %q, %v; want the data as it is", got, err)
+	}
+}
+
+func TestCompressorNames(t *testing.T) {
+	if got, want := compressorNames(), "gzip, zstd"; got != want {
+		t.Errorf("compressorNames() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lxc/lxd/lxd/resources"
+	"github.com/lxc/lxd/shared/api"
+)
+
+// cpu is the LXD CPU information, with frequency limits and power ratings
+// added to the sockets and the kernel's view of which CPU vulnerabilities
+// affect it. Vulnerabilities maps each one the kernel knows of to its
+// status, such as "Not affected" or "Mitigation: PTI".
+type cpu struct {
+	api.ResourcesCPU `yaml:",inline"`
+	Sockets          []cpuSocket       `json:"sockets" yaml:"sockets"`
+	Vulnerabilities  map[string]string `json:"vulnerabilities,omitempty" yaml:"vulnerabilities,omitempty"`
+}
+
+// MarshalYAML marshals the CPU by way of its JSON, since Sockets shadows a
+// field of the inlined LXD struct.
+func (c cpu) MarshalYAML() (interface{}, error) {
+	return yamlViaJSON(c)
+}
+
+// cpuSocket is an LXD socket with the highest frequency limits of its cores,
+// in kHz as cpufreq reports them, and its thermal design power as RAPL
+// reports it. Caches lists every cache of the socket's CPUs and which of
+// them share it, where LXD's Cache only describes those of the first.
+type cpuSocket struct {
+	api.ResourcesCPUSocket `yaml:",inline"`
+	Cores                  []cpuCore  `json:"cores" yaml:"cores"`
+	Caches                 []cpuCache `json:"caches,omitempty" yaml:"caches,omitempty"`
+	MaxFrequencyKHz        uint64     `json:"max_frequency_khz,omitempty" yaml:"max_frequency_khz,omitempty"`
+	BaseFrequencyKHz       uint64     `json:"base_frequency_khz,omitempty" yaml:"base_frequency_khz,omitempty"`
+	TDPWatts               float64    `json:"tdp_watts,omitempty" yaml:"tdp_watts,omitempty"`
+}
+
+// cpuCore is an LXD core with its frequency limits, which differ between
+// the kinds of core on hybrid CPUs. The base frequency is only known with
+// the intel_pstate driver.
+type cpuCore struct {
+	api.ResourcesCPUCore `yaml:",inline"`
+	MaxFrequencyKHz      uint64 `json:"max_frequency_khz,omitempty" yaml:"max_frequency_khz,omitempty"`
+	BaseFrequencyKHz     uint64 `json:"base_frequency_khz,omitempty" yaml:"base_frequency_khz,omitempty"`
+}
+
+// getVulnerabilities reads the kernel's CPU vulnerability status, which it
+// only exposes since 4.15. It returns nil if the directory is missing.
+func getVulnerabilities() map[string]string {
+	dir := sysfsPath("devices/system/cpu/vulnerabilities")
+	var vulnerabilities map[string]string
+	for _, name := range listDir(dir) {
+		status, err := readString(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		if vulnerabilities == nil {
+			vulnerabilities = make(map[string]string)
+		}
+		vulnerabilities[name] = status
+	}
+	return vulnerabilities
+}
+
+// addFrequencyLimits fills in core's frequency limits from the cpufreq
+// directory of its first thread.
+func addFrequencyLimits(core *cpuCore) {
+	if len(core.Threads) == 0 {
+		return
+	}
+	dir := sysfsPath(
+		"devices/system/cpu", "cpu"+strconv.FormatInt(core.Threads[0].ID, 10), "cpufreq")
+	core.MaxFrequencyKHz, _ = readUint(filepath.Join(dir, "cpuinfo_max_freq"))
+	core.BaseFrequencyKHz, _ = readUint(filepath.Join(dir, "base_frequency"))
+}
+
+// getRAPLPackagePower returns the long term power limit of each package
+// RAPL reports on, in watts and keyed by package number. That limit is the
+// package's TDP unless the firmware has been set up otherwise.
+func getRAPLPackagePower() map[uint64]float64 {
+	dirs, _ := filepath.Glob(sysfsPath("class/powercap/intel-rapl:*"))
+	power := make(map[uint64]float64)
+	for _, dir := range dirs {
+		// Subzones, such as intel-rapl:0:0 for the cores, are nested
+		// within the package zones but also listed at the top.
+		name, _ := readString(filepath.Join(dir, "name"))
+		pkg := strings.TrimPrefix(name, "package-")
+		if pkg == name {
+			continue
+		}
+		number, err := strconv.ParseUint(pkg, 10, 64)
+		if err != nil {
+			continue
+		}
+		for constraint := 0; ; constraint++ {
+			prefix := filepath.Join(dir, "constraint_"+strconv.Itoa(constraint)+"_")
+			constraintName, err := readString(prefix + "name")
+			if err != nil {
+				break
+			}
+			if constraintName != "long_term" {
+				continue
+			}
+			microwatts, err := readUint(prefix + "max_power_uw")
+			if err != nil || microwatts == 0 {
+				microwatts, err = readUint(prefix + "power_limit_uw")
+			}
+			if err == nil && microwatts > 0 {
+				power[number] = float64(microwatts) / 1e6
+			}
+			break
+		}
+	}
+	return power
+}
+
+func getCPU() (*cpu, error) {
+	lxdCPU, err := resources.GetCPU()
+	if err != nil {
+		return nil, err
+	}
+	c := &cpu{
+		ResourcesCPU:    *lxdCPU,
+		Sockets:         make([]cpuSocket, len(lxdCPU.Sockets)),
+		Vulnerabilities: getVulnerabilities(),
+	}
+	power := getRAPLPackagePower()
+	for i, lxdSocket := range lxdCPU.Sockets {
+		socket := &c.Sockets[i]
+		socket.ResourcesCPUSocket = lxdSocket
+		socket.Cores = make([]cpuCore, len(lxdSocket.Cores))
+		var threads []int64
+		for j, lxdCore := range lxdSocket.Cores {
+			core := &socket.Cores[j]
+			core.ResourcesCPUCore = lxdCore
+			for _, thread := range lxdCore.Threads {
+				threads = append(threads, thread.ID)
+			}
+			addFrequencyLimits(core)
+			if core.MaxFrequencyKHz > socket.MaxFrequencyKHz {
+				socket.MaxFrequencyKHz = core.MaxFrequencyKHz
+			}
+			if core.BaseFrequencyKHz > socket.BaseFrequencyKHz {
+				socket.BaseFrequencyKHz = core.BaseFrequencyKHz
+			}
+		}
+		socket.TDPWatts = power[lxdSocket.Socket]
+		socket.Caches = getCPUCaches(threads)
+	}
+	return c, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lxc/lxd/shared/api"
+)
+
+func TestGetVulnerabilities(t *testing.T) {
+	useRoots(t, "testdata/cpu")
+	want := map[string]string{
+		"gather_data_sampling": "Vulnerable: No microcode",
+		"mds":                  "Mitigation: Clear CPU buffers; SMT vulnerable",
+		"meltdown":             "Not affected",
+		"spectre_v1":           "Mitigation: usercopy/swapgs barriers and __user pointer sanitization",
+		"spectre_v2":           "Mitigation: Enhanced / Automatic IBRS; IBPB: conditional; RSB filling; PBRSB-eIBRS: SW sequence; BHI: BHI_DIS_S",
+	}
+	if got := getVulnerabilities(); !reflect.DeepEqual(got, want) {
+		t.Errorf("getVulnerabilities() = %v, want %v", got, want)
+	}
+}
+
+func TestGetVulnerabilitiesOldKernel(t *testing.T) {
+	// Kernels before 4.15 have no vulnerabilities directory.
+	useRoots(t, "testdata/sysfs")
+	if got := getVulnerabilities(); got != nil {
+		t.Errorf("getVulnerabilities() = %v, want nil", got)
+	}
+}
+
+func TestAddFrequencyLimits(t *testing.T) {
+	useRoots(t, "testdata/cpu")
+	core := func(thread int64) *cpuCore {
+		return &cpuCore{ResourcesCPUCore: api.ResourcesCPUCore{
+			Threads: []api.ResourcesCPUThread{{ID: thread}, {ID: thread + 1}},
+		}}
+	}
+	tests := []struct {
+		name    string
+		core    *cpuCore
+		maxKHz  uint64
+		baseKHz uint64
+	}{
+		{name: "intel_pstate", core: core(0), maxKHz: 4700000, baseKHz: 2100000},
+		// Other cpufreq drivers don't report a base frequency.
+		{name: "acpi-cpufreq", core: core(4), maxKHz: 3600000},
+		{name: "no cpufreq", core: core(8)},
+		{name: "no threads", core: &cpuCore{}},
+	}
+	for _, test := range tests {
+		addFrequencyLimits(test.core)
+		if test.core.MaxFrequencyKHz != test.maxKHz || test.core.BaseFrequencyKHz != test.baseKHz {
+			t.Errorf("%s: frequencies = %d, %d kHz; want %d, %d kHz", test.name,
+				test.core.MaxFrequencyKHz, test.core.BaseFrequencyKHz, test.maxKHz, test.baseKHz)
+		}
+	}
+}
+
+func TestGetRAPLPackagePower(t *testing.T) {
+	useRoots(t, "testdata/cpu")
+	// Package 0's long term limit falls back to power_limit_uw, since its
+	// max_power_uw is 0. The core and psys zones aren't packages, and the
+	// MMIO zone duplicates package 0.
+	want := map[uint64]float64{0: 125, 1: 165.5}
+	if got := getRAPLPackagePower(); !reflect.DeepEqual(got, want) {
+		t.Errorf("getRAPLPackagePower() = %v, want %v", got, want)
+	}
+}
+
+func TestGetRAPLPackagePowerMissing(t *testing.T) {
+	useRoots(t, "testdata/sysfs")
+	if got := getRAPLPackagePower(); len(got) != 0 {
+		t.Errorf("getRAPLPackagePower() = %v without powercap, want none", got)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// cacheTypeOrder is the order caches of the same level are listed in.
+var cacheTypeOrder = map[string]int{"Data": 0, "Instruction": 1, "Unified": 2}
+
+// cpuCache is a single CPU cache. Type is "Data", "Instruction" or
+// "Unified", and SharedCPUList is the kernel's list of the logical CPUs that
+// share it, such as "0-3,8-11".
+type cpuCache struct {
+	Level         uint64 `json:"level" yaml:"level"`
+	Type          string `json:"type" yaml:"type"`
+	SizeBytes     uint64 `json:"size_bytes" yaml:"size_bytes"`
+	LineSize      uint64 `json:"line_size,omitempty" yaml:"line_size,omitempty"`
+	SharedCPUList string `json:"shared_cpu_list" yaml:"shared_cpu_list"`
+	firstCPU      uint64
+}
+
+// parseCacheSize parses a cache size from sysfs, which is given in binary
+// units, as in "32K" or "16384K".
+func parseCacheSize(size string) (uint64, error) {
+	multiplier := uint64(1)
+	number := size
+	switch {
+	case strings.HasSuffix(size, "K"):
+		multiplier, number = 1<<10, strings.TrimSuffix(size, "K")
+	case strings.HasSuffix(size, "M"):
+		multiplier, number = 1<<20, strings.TrimSuffix(size, "M")
+	case strings.HasSuffix(size, "G"):
+		multiplier, number = 1<<30, strings.TrimSuffix(size, "G")
+	}
+	value, err := strconv.ParseUint(number, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cache size %q", size)
+	}
+	return value * multiplier, nil
+}
+
+// readCPUCache reads a cache/index* directory of a CPU.
+func readCPUCache(dir string) (cpuCache, error) {
+	var cache cpuCache
+	var err error
+	if cache.Level, err = readUint(filepath.Join(dir, "level")); err != nil {
+		return cpuCache{}, err
+	}
+	if cache.Type, err = readString(filepath.Join(dir, "type")); err != nil {
+		return cpuCache{}, err
+	}
+	size, err := readString(filepath.Join(dir, "size"))
+	if err != nil {
+		return cpuCache{}, err
+	}
+	if cache.SizeBytes, err = parseCacheSize(size); err != nil {
+		return cpuCache{}, err
+	}
+	cache.LineSize, _ = readUint(filepath.Join(dir, "coherency_line_size"))
+	if cache.SharedCPUList, err = readString(filepath.Join(dir, "shared_cpu_list")); err != nil {
+		return cpuCache{}, err
+	}
+	cpus, err := parseCPUList(cache.SharedCPUList)
+	if err != nil {
+		return cpuCache{}, err
+	}
+	if len(cpus) > 0 {
+		cache.firstCPU = cpus[0]
+	}
+	return cache, nil
+}
+
+// getCPUCaches returns the caches of the given logical CPUs, listing each
+// shared cache once however many of the CPUs share it. Caches are sorted by
+// level, then type, then the first CPU sharing them.
+func getCPUCaches(cpus []int64) []cpuCache {
+	type cacheID struct {
+		level     uint64
+		cacheType string
+		shared    string
+	}
+	seen := make(map[cacheID]bool)
+	var caches []cpuCache
+	for _, cpu := range cpus {
+		dir := sysfsPath("devices/system/cpu", "cpu"+strconv.FormatInt(cpu, 10), "cache")
+		for _, name := range listDir(dir) {
+			if !strings.HasPrefix(name, "index") {
+				continue
+			}
+			cache, err := readCPUCache(filepath.Join(dir, name))
+			if err != nil {
+				continue
+			}
+			id := cacheID{cache.Level, cache.Type, cache.SharedCPUList}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			caches = append(caches, cache)
+		}
+	}
+	sort.Slice(caches, func(i, j int) bool {
+		a, b := caches[i], caches[j]
+		if a.Level != b.Level {
+			return a.Level < b.Level
+		}
+		if a.Type != b.Type {
+			return cacheTypeOrder[a.Type] < cacheTypeOrder[b.Type]
+		}
+		return a.firstCPU < b.firstCPU
+	})
+	return caches
+}
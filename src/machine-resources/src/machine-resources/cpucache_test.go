@@ -0,0 +1,92 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetCPUCaches(t *testing.T) {
+	useRoots(t, "testdata/cpu")
+	cache := func(level uint64, cacheType string, size uint64, shared string, first uint64) cpuCache {
+		return cpuCache{
+			Level: level, Type: cacheType, SizeBytes: size, LineSize: 64,
+			SharedCPUList: shared, firstCPU: first,
+		}
+	}
+	tests := []struct {
+		name string
+		cpus []int64
+		want []cpuCache
+	}{
+		{
+			// Each core's threads share its L1 and L2, and all the
+			// cores share the L3. CPU 3's L4 has no size, so it's
+			// left out.
+			name: "socket",
+			cpus: []int64{0, 1, 2, 3},
+			want: []cpuCache{
+				cache(1, "Data", 48<<10, "0-1", 0),
+				cache(1, "Data", 48<<10, "2-3", 2),
+				cache(1, "Instruction", 32<<10, "0-1", 0),
+				cache(1, "Instruction", 32<<10, "2-3", 2),
+				cache(2, "Unified", 1280<<10, "0-1", 0),
+				cache(2, "Unified", 1280<<10, "2-3", 2),
+				cache(3, "Unified", 24<<20, "0-3", 0),
+			},
+		},
+		{
+			name: "core",
+			cpus: []int64{3, 2},
+			want: []cpuCache{
+				cache(1, "Data", 48<<10, "2-3", 2),
+				cache(1, "Instruction", 32<<10, "2-3", 2),
+				cache(2, "Unified", 1280<<10, "2-3", 2),
+				cache(3, "Unified", 24<<20, "0-3", 0),
+			},
+		},
+		{
+			// CPU 4 only has cpufreq in the fixture.
+			name: "no caches",
+			cpus: []int64{4},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := getCPUCaches(test.cpus); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("getCPUCaches(%v) =\n%+v\nwant\n%+v", test.cpus, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseCacheSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    uint64
+		wantErr bool
+	}{
+		{size: "32K", want: 32 << 10},
+		{size: "16384K", want: 16 << 20},
+		{size: "24M", want: 24 << 20},
+		{size: "1G", want: 1 << 30},
+		{size: "512", want: 512},
+		{size: "1.5M", wantErr: true},
+		{size: "K", wantErr: true},
+		{size: "", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseCacheSize(test.size)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseCacheSize(%q) = %d, want an error", test.size, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseCacheSize(%q) = %d, %v; want %d", test.size, got, err, test.want)
+		}
+	}
+}
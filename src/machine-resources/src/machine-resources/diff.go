@@ -0,0 +1,141 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Kinds of change reported by --diff.
+const (
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeChanged = "changed"
+)
+
+// change is a single difference between a baseline report and a fresh one.
+// Path is the dotted path of the value, as used in volatileFields.
+type change struct {
+	Path   string      `json:"path" yaml:"path"`
+	Change string      `json:"change" yaml:"change"`
+	Old    interface{} `json:"old,omitempty" yaml:"old,omitempty"`
+	New    interface{} `json:"new,omitempty" yaml:"new,omitempty"`
+}
+
+// diffReport is what --diff emits.
+type diffReport struct {
+	Changes []change `json:"changes" yaml:"changes"`
+}
+
+// loadBaseline reads a saved report, with or without the envelope, and
+// returns the generic representation of its resources.
+func loadBaseline(path string) (interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var baseline interface{}
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("invalid baseline %s: %v", path, err)
+	}
+	if m, ok := baseline.(map[string]interface{}); ok {
+		if _, wrapped := m["api_version"]; wrapped {
+			return m["resources"], nil
+		}
+	}
+	return baseline, nil
+}
+
+func joinPath(path, elem string) string {
+	if path == "" {
+		return elem
+	}
+	return path + "." + elem
+}
+
+// diffValues returns the changes between two generic JSON values. Array
+// elements are compared by index.
+func diffValues(path string, old, new interface{}) []change {
+	switch oldValue := old.(type) {
+	case map[string]interface{}:
+		newValue, ok := new.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make(map[string]bool)
+		for key := range oldValue {
+			keys[key] = true
+		}
+		for key := range newValue {
+			keys[key] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+		var changes []change
+		for _, key := range sorted {
+			o, inOld := oldValue[key]
+			n, inNew := newValue[key]
+			switch {
+			case !inOld:
+				changes = append(changes, change{Path: joinPath(path, key), Change: changeAdded, New: n})
+			case !inNew:
+				changes = append(changes, change{Path: joinPath(path, key), Change: changeRemoved, Old: o})
+			default:
+				changes = append(changes, diffValues(joinPath(path, key), o, n)...)
+			}
+		}
+		return changes
+	case []interface{}:
+		newValue, ok := new.([]interface{})
+		if !ok {
+			break
+		}
+		var changes []change
+		for i := 0; i < len(oldValue) || i < len(newValue); i++ {
+			elemPath := joinPath(path, fmt.Sprint(i))
+			switch {
+			case i >= len(oldValue):
+				changes = append(changes, change{Path: elemPath, Change: changeAdded, New: newValue[i]})
+			case i >= len(newValue):
+				changes = append(changes, change{Path: elemPath, Change: changeRemoved, Old: oldValue[i]})
+			default:
+				changes = append(changes, diffValues(elemPath, oldValue[i], newValue[i])...)
+			}
+		}
+		return changes
+	}
+	if reflect.DeepEqual(old, new) {
+		return nil
+	}
+	return []change{{Path: path, Change: changeChanged, Old: old, New: new}}
+}
+
+// diffResources compares a baseline against freshly collected resources,
+// ignoring volatileFields unless all is set.
+func diffResources(baseline interface{}, r *machineResources, all bool) ([]change, error) {
+	var ignored []string
+	if !all {
+		ignored = volatileFields
+	}
+	current, err := stripFields(r, ignored)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range ignored {
+		baseline = removePath(baseline, strings.Split(field, "."))
+	}
+	changes := diffValues("", baseline, current)
+	if changes == nil {
+		changes = []change{}
+	}
+	return changes, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffResources(t *testing.T) {
+	current := &machineResources{
+		DMI: &dmiInfo{
+			SystemVendor: "Dell Inc.",
+			ProductName:  "PowerEdge R640",
+			BoardSerial:  ".7XK1234.CN1374073A0456.",
+		},
+		NUMA: []numaNode{
+			{NodeID: 0, CPUs: []uint64{0, 1}, MemoryBytes: 8589934592},
+			{NodeID: 1, CPUs: []uint64{2, 3}, MemoryBytes: 8589934592},
+		},
+		Sensors: []sensorReading{{Chip: "coretemp", Label: "Package id 0", Type: "temperature", Value: 55}},
+	}
+	tests := []struct {
+		name string
+		all  bool
+		want []string
+	}{
+		{"stable fields", false, []string{"dmi.board_serial changed", "numa.1 added"}},
+		{"all fields", true, []string{"dmi.board_serial changed", "numa.1 added", "sensors.0.value changed"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			baseline, err := loadBaseline("testdata/diff/baseline.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			changes, err := diffResources(baseline, current, test.all)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, c := range changes {
+				got = append(got, c.Path+" "+c.Change)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("changes = %v, want %v", got, test.want)
+			}
+			if len(changes) > 0 && (changes[0].Old != ".7XK1234.CN1374073A0123." || changes[0].New != ".7XK1234.CN1374073A0456.") {
+				t.Errorf("serial change = %+v, want the old and new serials", changes[0])
+			}
+		})
+	}
+}
+
+func TestDiffResourcesUnchanged(t *testing.T) {
+	baseline, err := loadBaseline("testdata/diff/baseline-bare.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := &machineResources{DMI: &dmiInfo{
+		SystemVendor: "Dell Inc.",
+		ProductName:  "PowerEdge R640",
+		BoardSerial:  ".7XK1234.CN1374073A0123.",
+	}}
+	changes, err := diffResources(baseline, current, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An empty list rather than nil, so that JSON output has "changes": [].
+	if changes == nil || len(changes) != 0 {
+		t.Errorf("changes = %#v, want none", changes)
+	}
+}
+
+func TestDiffResourcesVirtualInterfaces(t *testing.T) {
+	baseline, err := toGeneric(&machineResources{Network: &network{Interfaces: []networkInterface{
+		{Name: "eno1", Type: ifacePhysical},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := &machineResources{Network: &network{Interfaces: []networkInterface{
+		{Name: "eno1", Type: ifacePhysical},
+		{Name: "tap0", Type: ifaceOther},
+	}}}
+	for all, want := range map[bool][]string{false: nil, true: {"network.interfaces.1 added"}} {
+		changes, err := diffResources(baseline, current, all)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, c := range changes {
+			got = append(got, c.Path+" "+c.Change)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("all = %t: changes = %v, want %v", all, got, want)
+		}
+	}
+}
+
+func TestDiffValuesRemoved(t *testing.T) {
+	old := map[string]interface{}{"gpu": map[string]interface{}{"total": 1.0}, "usb": []interface{}{"a", "b"}}
+	new := map[string]interface{}{"usb": []interface{}{"a"}}
+	want := []change{
+		{Path: "gpu", Change: changeRemoved, Old: map[string]interface{}{"total": 1.0}},
+		{Path: "usb.1", Change: changeRemoved, Old: "b"},
+	}
+	if got := diffValues("", old, new); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffValues() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadBaselineInvalid(t *testing.T) {
+	for _, path := range []string{"testdata/diff/invalid.json", "testdata/diff/missing.json"} {
+		if _, err := loadBaseline(path); err == nil {
+			t.Errorf("loadBaseline(%q) succeeded", path)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"path/filepath"
+)
+
+// dmiPath is where the kernel exposes SMBIOS/DMI information, relative to
+// the sysfs root.
+const dmiPath = "class/dmi/id"
+
+// dmiInfo is the SMBIOS/DMI system information. Fields that the firmware
+// doesn't provide are left empty and omitted.
+type dmiInfo struct {
+	SystemVendor  string `json:"sys_vendor,omitempty" yaml:"sys_vendor,omitempty"`
+	ProductName   string `json:"product_name,omitempty" yaml:"product_name,omitempty"`
+	BoardSerial   string `json:"board_serial,omitempty" yaml:"board_serial,omitempty"`
+	ChassisSerial string `json:"chassis_serial,omitempty" yaml:"chassis_serial,omitempty"`
+	BIOSVersion   string `json:"bios_version,omitempty" yaml:"bios_version,omitempty"`
+	BIOSDate      string `json:"bios_date,omitempty" yaml:"bios_date,omitempty"`
+}
+
+// getDMI reads DMI information from dir, normally dmiPath under the sysfs
+// root. Missing or unreadable files are skipped, and nil is returned if
+// nothing could be read at all, as on many VMs and non-x86 machines. The
+// serial numbers are only readable by root; denied is called with the name
+// of each field that couldn't be read for lack of permission.
+func getDMI(dir string, denied func(field string)) (*dmiInfo, error) {
+	info := &dmiInfo{}
+	fields := map[string]*string{
+		"sys_vendor":     &info.SystemVendor,
+		"product_name":   &info.ProductName,
+		"board_serial":   &info.BoardSerial,
+		"chassis_serial": &info.ChassisSerial,
+		"bios_version":   &info.BIOSVersion,
+		"bios_date":      &info.BIOSDate,
+	}
+	found := false
+	for name, field := range fields {
+		value, err := readString(filepath.Join(dir, name))
+		if deniedPermission(nil, err) {
+			denied(name)
+		}
+		if err != nil || value == "" {
+			continue
+		}
+		*field = value
+		found = true
+	}
+	if !found {
+		return nil, nil
+	}
+	return info, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetDMI(t *testing.T) {
+	useRoots(t, "testdata/dmi")
+	info, err := getDMI(sysfsPath(dmiPath), func(field string) {
+		t.Errorf("denied %s", field)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := dmiInfo{
+		SystemVendor:  "Dell Inc.",
+		ProductName:   "PowerEdge R640",
+		BoardSerial:   ".7XK1234.CN1374073A0123.",
+		ChassisSerial: "7XK1234",
+		BIOSVersion:   "2.17.1",
+		BIOSDate:      "11/14/2022",
+	}
+	if info == nil || *info != want {
+		t.Errorf("getDMI() = %+v, want %+v", info, want)
+	}
+}
+
+// VMs and non-x86 machines often have no DMI, or only empty files.
+func TestGetDMIMissing(t *testing.T) {
+	for _, root := range []string{"testdata/dmi-empty", "testdata/no-such-root"} {
+		useRoots(t, root)
+		info, err := getDMI(sysfsPath(dmiPath), func(string) {})
+		if err != nil || info != nil {
+			t.Errorf("%s: getDMI() = %+v, %v; want nil, nil", root, info, err)
+		}
+	}
+}
+
+// The serial numbers are only readable by root.
+func TestGetDMIPermissionDenied(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read files regardless of their mode")
+	}
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "sys_vendor"), []byte("Dell Inc.\n"))
+	writeTestFile(t, filepath.Join(dir, "board_serial"), []byte("CN1374073A0123\n"))
+	if err := os.Chmod(filepath.Join(dir, "board_serial"), 0); err != nil {
+		t.Fatal(err)
+	}
+	r := &machineResources{}
+	info, err := getDMI(dir, r.permissionDenied("dmi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info == nil || info.SystemVendor != "Dell Inc." || info.BoardSerial != "" {
+		t.Errorf("getDMI() = %+v, want only the vendor", info)
+	}
+	if len(r.RequiresRoot) != 1 || r.RequiresRoot[0] != "dmi.board_serial" {
+		t.Errorf("requires_root = %v, want [dmi.board_serial]", r.RequiresRoot)
+	}
+}
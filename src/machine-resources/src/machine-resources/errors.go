@@ -0,0 +1,74 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// errorReport is how an error is written with --error-format=json.
+type errorReport struct {
+	Error     string `json:"error"`
+	Subsystem string `json:"subsystem,omitempty"`
+	Code      int    `json:"code"`
+}
+
+// warningReport is how a warning is written with --error-format=json.
+type warningReport struct {
+	Warning string `json:"warning"`
+}
+
+// errorReporter writes errors to stderr, so that stdout only ever carries
+// the report itself.
+type errorReporter struct {
+	json bool
+	out  io.Writer
+}
+
+func newErrorReporter(format string) (*errorReporter, error) {
+	switch format {
+	case "text":
+		return &errorReporter{out: os.Stderr}, nil
+	case "json":
+		return &errorReporter{json: true, out: os.Stderr}, nil
+	}
+	return nil, fmt.Errorf(
+		"unknown error format %q (expected one of: json, text)", format)
+}
+
+// report writes err, which happened in subsystem if that isn't empty, and
+// which leads to exit code code.
+func (e *errorReporter) report(subsystem string, err error, code int) {
+	if e.json {
+		data, _ := json.Marshal(errorReport{
+			Error:     err.Error(),
+			Subsystem: subsystem,
+			Code:      code,
+		})
+		fmt.Fprintf(e.out, "%s\n", data)
+	} else if subsystem != "" {
+		fmt.Fprintf(e.out, "error: %s: %v\n", subsystem, err)
+	} else {
+		fmt.Fprintf(e.out, "error: %v\n", err)
+	}
+}
+
+// warn writes a warning, which doesn't affect the exit code.
+func (e *errorReporter) warn(warning string) {
+	if e.json {
+		data, _ := json.Marshal(warningReport{Warning: warning})
+		fmt.Fprintf(e.out, "%s\n", data)
+	} else {
+		fmt.Fprintf(e.out, "warning: %s\n", warning)
+	}
+}
+
+// fatal reports err and exits with code.
+func (e *errorReporter) fatal(subsystem string, err error, code int) {
+	e.report(subsystem, err, code)
+	os.Exit(code)
+}
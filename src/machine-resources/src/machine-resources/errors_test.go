@@ -0,0 +1,61 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestErrorReporter(t *testing.T) {
+	tests := []struct {
+		format    string
+		subsystem string
+		want      string
+	}{
+		{"text", "", "error: no such device\n"},
+		{"text", "storage", "error: storage: no such device\n"},
+		{"json", "", `{"error":"no such device","code":1}` + "\n"},
+		{"json", "storage", `{"error":"no such device","subsystem":"storage","code":1}` + "\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.format+"/"+test.subsystem, func(t *testing.T) {
+			reporter, err := newErrorReporter(test.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			reporter.out = &buf
+			reporter.report(test.subsystem, errors.New("no such device"), exitFailure)
+			if buf.String() != test.want {
+				t.Errorf("reported %q, want %q", buf.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestErrorReporterWarn(t *testing.T) {
+	for format, want := range map[string]string{
+		"text": "warning: not running as root\n",
+		"json": `{"warning":"not running as root"}` + "\n",
+	} {
+		reporter, err := newErrorReporter(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		reporter.out = &buf
+		reporter.warn("not running as root")
+		if buf.String() != want {
+			t.Errorf("%s: warned %q, want %q", format, buf.String(), want)
+		}
+	}
+}
+
+func TestNewErrorReporterUnknownFormat(t *testing.T) {
+	if _, err := newErrorReporter("xml"); err == nil {
+		t.Error("newErrorReporter() with an unknown format succeeded")
+	}
+}
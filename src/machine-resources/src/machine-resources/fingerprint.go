@@ -0,0 +1,174 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"strings"
+)
+
+// volatileFields are dotted paths into the JSON report of values that change
+// from one run to the next without the hardware changing. A "*" matches any
+// array index or object key, and "[key=value]" the array elements that are
+// objects with that value for key.
+var volatileFields = []string{
+	"cpu.sockets.*.frequency",
+	"cpu.sockets.*.cores.*.frequency",
+	"memory.used",
+	"memory.hugepages_used",
+	"memory.nodes.*.used",
+	"memory.nodes.*.hugepages_used",
+	// Interfaces that aren't a bond, bridge, VLAN or device, such as veth
+	// and tap, come and go with containers and VMs.
+	"network.interfaces.[type=" + ifaceOther + "]",
+	"network.interfaces.*.wireless.ssid",
+	"network.interfaces.*.wireless.signal_dbm",
+	"infiniband.*.ports.*.state",
+	"infiniband.*.ports.*.physical_state",
+	"infiniband.*.ports.*.rate",
+	"infiniband.*.ports.*.rate_gbps",
+	"storage.disks.*.has_mounts",
+	"storage.disks.*.partitions.*.mountpoint",
+	"storage.disks.*.smart.power_on_hours",
+	"storage.disks.*.smart.temperature_celsius",
+	"power.*.online",
+	"power.*.capacity_percent",
+	"power.*.status",
+	"sensors",
+	// Device numbers are handed out again on every replug and reboot.
+	"usb.devices.*.device_address",
+	// The kernel and OS are upgraded, and the kernel's command line
+	// edited, without the hardware changing; vulnerabilities change with
+	// them and with microcode.
+	"system_software",
+	"cpu.vulnerabilities",
+	// The BMC's address is configuration, which MAAS changes.
+	"bmc.lan.address_source",
+	"bmc.lan.ip_address",
+	"bmc.lan.subnet_mask",
+	"bmc.lan.default_gateway",
+	// Uptime changes on every run, and the rest of the boot section on
+	// every reboot.
+	"boot",
+	// Boot options are configuration, which deploying changes.
+	"firmware.boot_current",
+	"firmware.boot_order",
+	"firmware.boot_entries",
+	// Collection failures and timings say nothing about the hardware
+	// itself.
+	"errors",
+	"requires_root",
+	"_timings",
+}
+
+// toGeneric round-trips v through JSON, returning its generic
+// representation of maps, slices and scalars.
+func toGeneric(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// elementSelector parses a "[key=value]" path component.
+func elementSelector(component string) (key, value string, ok bool) {
+	if !strings.HasPrefix(component, "[") || !strings.HasSuffix(component, "]") {
+		return "", "", false
+	}
+	return strings.Cut(component[1:len(component)-1], "=")
+}
+
+// selects reports whether the array element v is matched by the path
+// component, which is "*" or a "[key=value]" selector.
+func selects(component string, v interface{}) bool {
+	if component == "*" {
+		return true
+	}
+	key, value, ok := elementSelector(component)
+	if !ok {
+		return false
+	}
+	object, isObject := v.(map[string]interface{})
+	return isObject && object[key] == value
+}
+
+// removePath deletes the value at the given path components from a generic
+// JSON value, expanding "*" to every element, and returns the result. Arrays
+// are replaced rather than changed in place when elements are removed.
+func removePath(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return v
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if path[0] == "*" {
+			for key, child := range v {
+				if len(path) == 1 {
+					delete(v, key)
+				} else {
+					v[key] = removePath(child, path[1:])
+				}
+			}
+		} else if len(path) == 1 {
+			delete(v, path[0])
+		} else if child, ok := v[path[0]]; ok {
+			v[path[0]] = removePath(child, path[1:])
+		}
+	case []interface{}:
+		// Only selected elements are removed, so that "*" can't empty an
+		// array by accident.
+		if _, _, ok := elementSelector(path[0]); ok && len(path) == 1 {
+			kept := []interface{}{}
+			for _, child := range v {
+				if !selects(path[0], child) {
+					kept = append(kept, child)
+				}
+			}
+			return kept
+		}
+		if len(path) > 1 {
+			for i, child := range v {
+				if selects(path[0], child) {
+					v[i] = removePath(child, path[1:])
+				}
+			}
+		}
+	}
+	return v
+}
+
+// stripFields returns the generic representation of v without the values at
+// the given dotted paths.
+func stripFields(v interface{}, fields []string) (interface{}, error) {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		generic = removePath(generic, strings.Split(field, "."))
+	}
+	return generic, nil
+}
+
+// canonicalFingerprint returns a SHA-256 hash of the stable parts of the
+// report, for telling whether the hardware changed between runs. The hash is
+// taken over JSON with sorted keys, so it doesn't depend on field order.
+func canonicalFingerprint(r *machineResources) ([32]byte, error) {
+	stable, err := stripFields(r, volatileFields)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	// encoding/json always sorts map keys, which makes this canonical.
+	data, err := json.Marshal(stable)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/lxc/lxd/shared/api"
+)
+
+// fingerprintTestResources returns a small report for the fingerprint tests
+// to change.
+func fingerprintTestResources() *machineResources {
+	return &machineResources{
+		Memory: &memory{ResourcesMemory: api.ResourcesMemory{Total: 17179869184, Used: 4294967296}},
+		DMI:    &dmiInfo{SystemVendor: "Dell Inc.", BoardSerial: "CN1374073A0123"},
+		Network: &network{Interfaces: []networkInterface{
+			{Name: "eno1", Type: ifacePhysical},
+			{Name: "virbr0", Type: ifaceBridge},
+		}},
+		Plugins: map[string]pluginOutput{
+			"location": {json.RawMessage(`{"rack": "r12", "slot": 4}`)},
+		},
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(r *machineResources)
+		wantSame bool
+	}{
+		{"unchanged", func(r *machineResources) {}, true},
+		{"free memory", func(r *machineResources) { r.Memory.Used = 8589934592 }, true},
+		{"keys reordered", func(r *machineResources) {
+			r.Plugins["location"] = pluginOutput{json.RawMessage(`{"slot": 4, "rack": "r12"}`)}
+		}, true},
+		{"errors", func(r *machineResources) { r.Errors = map[string]string{"gpu": "timed out"} }, true},
+		// A container starting adds a veth, still sorted among the rest.
+		{"veth", func(r *machineResources) {
+			r.Network.Interfaces = []networkInterface{
+				{Name: "eno1", Type: ifacePhysical},
+				{Name: "veth1a2b3c", Type: ifaceOther},
+				{Name: "virbr0", Type: ifaceBridge},
+			}
+		}, true},
+		{"new NIC", func(r *machineResources) {
+			r.Network.Interfaces = append(r.Network.Interfaces, networkInterface{Name: "eno2", Type: ifacePhysical})
+		}, false},
+		{"swapped serial", func(r *machineResources) { r.DMI.BoardSerial = "CN1374073A0456" }, false},
+		{"more memory", func(r *machineResources) { r.Memory.Total = 34359738368 }, false},
+		{"plugin value", func(r *machineResources) {
+			r.Plugins["location"] = pluginOutput{json.RawMessage(`{"rack": "r12", "slot": 5}`)}
+		}, false},
+	}
+	base, err := canonicalFingerprint(fingerprintTestResources())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := fingerprintTestResources()
+			test.change(r)
+			got, err := canonicalFingerprint(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if same := got == base; same != test.wantSame {
+				t.Errorf("fingerprint unchanged = %t, want %t", same, test.wantSame)
+			}
+		})
+	}
+}
+
+func TestStripFields(t *testing.T) {
+	v := map[string]interface{}{
+		"cpu": map[string]interface{}{
+			"sockets": []interface{}{
+				map[string]interface{}{"frequency": 2400, "name": "Xeon"},
+			},
+		},
+		"sensors": []interface{}{"coretemp"},
+		"network": map[string]interface{}{
+			"interfaces": []interface{}{
+				map[string]interface{}{"name": "eno1", "type": "physical"},
+				map[string]interface{}{"name": "tap0", "type": "other"},
+			},
+		},
+	}
+	got, err := stripFields(v, []string{
+		"cpu.sockets.*.frequency", "sensors", "missing.field", "network.interfaces.[type=other]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"cpu":{"sockets":[{"name":"Xeon"}]},"network":{"interfaces":[{"name":"eno1","type":"physical"}]}}`; string(data) != want {
+		t.Errorf("stripFields() = %s, want %s", data, want)
+	}
+}
+
+// Upgrades and replugging change nothing about the hardware.
+func TestFingerprintIgnoresSoftwareAndDeviceNumbers(t *testing.T) {
+	before := &machineResources{
+		CPU:            &cpu{Vulnerabilities: map[string]string{"meltdown": "Vulnerable"}},
+		USB:            &usb{Devices: []usbDevice{{BusAddress: "1", DeviceAddress: "4"}}},
+		SystemSoftware: &systemSoftware{KernelRelease: "5.15.0-91-generic", KernelCmdline: "ro"},
+	}
+	after := &machineResources{
+		CPU:            &cpu{Vulnerabilities: map[string]string{"meltdown": "Mitigation: PTI"}},
+		USB:            &usb{Devices: []usbDevice{{BusAddress: "1", DeviceAddress: "9"}}},
+		SystemSoftware: &systemSoftware{KernelRelease: "6.5.0-14-generic", KernelCmdline: "ro quiet"},
+	}
+	first, err := canonicalFingerprint(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := canonicalFingerprint(after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("fingerprint changed with the kernel, vulnerabilities and USB device numbers")
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// Firmware types, as reported in firmware.type.
+const (
+	firmwareUEFI = "uefi"
+	firmwareBIOS = "bios"
+)
+
+// efiGlobalVariable is the GUID of the EFI variables the UEFI spec defines,
+// such as BootOrder.
+const efiGlobalVariable = "8be4df61-93ca-11d2-aa0d-00e098032b8c"
+
+// esrtTypes names the ESRT firmware types.
+var esrtTypes = map[uint64]string{
+	0: "unknown",
+	1: "system",
+	2: "device",
+	3: "uefi-driver",
+}
+
+// firmware is the system firmware and what it can do. Everything but Type
+// is only reported for UEFI machines. CapsuleUpdates is set when the
+// firmware publishes an ESRT, listing the components capsules can update.
+type firmware struct {
+	Type           string      `json:"type" yaml:"type"`
+	SecureBoot     *bool       `json:"secure_boot,omitempty" yaml:"secure_boot,omitempty"`
+	CapsuleUpdates bool        `json:"capsule_updates,omitempty" yaml:"capsule_updates,omitempty"`
+	ESRT           []esrtEntry `json:"esrt,omitempty" yaml:"esrt,omitempty"`
+	BootCurrent    string      `json:"boot_current,omitempty" yaml:"boot_current,omitempty"`
+	BootOrder      []string    `json:"boot_order,omitempty" yaml:"boot_order,omitempty"`
+	BootEntries    []bootEntry `json:"boot_entries,omitempty" yaml:"boot_entries,omitempty"`
+}
+
+// esrtEntry is an updatable firmware component from the EFI System Resource
+// Table. LastAttemptStatus is 0 if the last update succeeded.
+type esrtEntry struct {
+	Class                  string `json:"class" yaml:"class"`
+	Type                   string `json:"type" yaml:"type"`
+	Version                uint64 `json:"version" yaml:"version"`
+	LowestSupportedVersion uint64 `json:"lowest_supported_version" yaml:"lowest_supported_version"`
+	LastAttemptVersion     uint64 `json:"last_attempt_version" yaml:"last_attempt_version"`
+	LastAttemptStatus      uint64 `json:"last_attempt_status" yaml:"last_attempt_status"`
+}
+
+// bootEntry is an EFI Boot#### variable. ID is its four hex digits, as in
+// BootOrder.
+type bootEntry struct {
+	ID          string `json:"id" yaml:"id"`
+	Description string `json:"description" yaml:"description"`
+	Active      bool   `json:"active" yaml:"active"`
+}
+
+// bootVariable matches the names of Boot#### variables.
+var bootVariable = regexp.MustCompile(`^Boot([0-9A-F]{4})-` + efiGlobalVariable + `$`)
+
+// readEFIVariable returns the data of an EFI variable, without the 4 bytes
+// of attributes that start the efivarfs file.
+func readEFIVariable(name string) ([]byte, error) {
+	data, err := ioutil.ReadFile(sysfsPath("firmware/efi/efivars", name+"-"+efiGlobalVariable))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("EFI variable %s is truncated", name)
+	}
+	return data[4:], nil
+}
+
+// parseLoadOption parses an EFI_LOAD_OPTION, the data of a Boot####
+// variable: 32 bits of attributes, the 16 bit length of the device path
+// list, then a NUL terminated UTF-16 description.
+func parseLoadOption(id string, data []byte) (bootEntry, error) {
+	if len(data) < 6 {
+		return bootEntry{}, fmt.Errorf("Boot%s is truncated", id)
+	}
+	const loadOptionActive = 0x1
+	entry := bootEntry{
+		ID:     id,
+		Active: binary.LittleEndian.Uint32(data)&loadOptionActive != 0,
+	}
+	var description []uint16
+	for i := 6; i+1 < len(data); i += 2 {
+		c := binary.LittleEndian.Uint16(data[i:])
+		if c == 0 {
+			break
+		}
+		description = append(description, c)
+	}
+	entry.Description = string(utf16.Decode(description))
+	return entry, nil
+}
+
+// parseBootNumbers parses a list of 16 bit boot option numbers, as in
+// BootOrder, into their hex IDs.
+func parseBootNumbers(data []byte) []string {
+	var ids []string
+	for i := 0; i+1 < len(data); i += 2 {
+		ids = append(ids, fmt.Sprintf("%04X", binary.LittleEndian.Uint16(data[i:])))
+	}
+	return ids
+}
+
+// readSecureBoot returns whether secure boot is enabled, or nil if the
+// firmware doesn't expose the variable.
+func readSecureBoot() *bool {
+	data, err := readEFIVariable("SecureBoot")
+	if err != nil || len(data) < 1 {
+		return nil
+	}
+	enabled := data[0] == 1
+	return &enabled
+}
+
+// getESRT returns the entries of the EFI System Resource Table, in entry
+// order.
+func getESRT() []esrtEntry {
+	dir := sysfsPath("firmware/efi/esrt/entries")
+	names := listDir(dir)
+	sort.Slice(names, func(i, j int) bool { return naturalLess(names[i], names[j]) })
+	var entries []esrtEntry
+	for _, name := range names {
+		entryDir := filepath.Join(dir, name)
+		class, err := readString(filepath.Join(entryDir, "fw_class"))
+		if err != nil {
+			continue
+		}
+		entry := esrtEntry{Class: strings.ToLower(class), Type: esrtTypes[0]}
+		if fwType, err := readUint(filepath.Join(entryDir, "fw_type")); err == nil {
+			if name, ok := esrtTypes[fwType]; ok {
+				entry.Type = name
+			}
+		}
+		entry.Version, _ = readUint(filepath.Join(entryDir, "fw_version"))
+		entry.LowestSupportedVersion, _ = readUint(filepath.Join(entryDir, "lowest_supported_fw_version"))
+		entry.LastAttemptVersion, _ = readUint(filepath.Join(entryDir, "last_attempt_version"))
+		entry.LastAttemptStatus, _ = readUint(filepath.Join(entryDir, "last_attempt_status"))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// getBootEntries returns the EFI boot options, sorted by ID.
+func getBootEntries() []bootEntry {
+	var entries []bootEntry
+	for _, name := range listDir(sysfsPath("firmware/efi/efivars")) {
+		match := bootVariable.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+		data, err := readEFIVariable("Boot" + match[1])
+		if err != nil {
+			continue
+		}
+		if entry, err := parseLoadOption(match[1], data); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries
+}
+
+// getFirmware reports the firmware type and, on UEFI machines, its secure
+// boot state, updatable components and boot options.
+func getFirmware() (*firmware, error) {
+	if !exists(sysfsPath("firmware/efi")) {
+		return &firmware{Type: firmwareBIOS}, nil
+	}
+	f := &firmware{Type: firmwareUEFI, SecureBoot: readSecureBoot()}
+	f.CapsuleUpdates = exists(sysfsPath("firmware/efi/esrt"))
+	f.ESRT = getESRT()
+	if data, err := readEFIVariable("BootCurrent"); err == nil {
+		if ids := parseBootNumbers(data); len(ids) > 0 {
+			f.BootCurrent = ids[0]
+		}
+	}
+	if data, err := readEFIVariable("BootOrder"); err == nil {
+		f.BootOrder = parseBootNumbers(data)
+	}
+	f.BootEntries = getBootEntries()
+	return f, nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetFirmware(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    *firmware
+	}{
+		{
+			fixture: "uefi",
+			want: &firmware{
+				Type:           firmwareUEFI,
+				SecureBoot:     boolPtr(true),
+				CapsuleUpdates: true,
+				ESRT: []esrtEntry{
+					{
+						Class: "ddc0ee61-e7f0-4e7d-acc5-c070a398838e", Type: "system",
+						Version: 65586, LowestSupportedVersion: 65536, LastAttemptVersion: 65586,
+					},
+					{
+						Class: "67d1c1e0-5e9f-4a4c-9b3a-2a3f1b0c4d5e", Type: "device",
+						Version: 7, LastAttemptVersion: 6, LastAttemptStatus: 1,
+					},
+					// entry10 comes after entry1, and has a type the
+					// spec doesn't define.
+					{
+						Class: "0e5f3a2b-1c4d-4e6f-8a9b-0c1d2e3f4a5b", Type: "unknown",
+						Version: 3, LowestSupportedVersion: 3,
+					},
+				},
+				BootCurrent: "0001",
+				BootOrder:   []string{"0001", "0000", "000A"},
+				// Boot0003 is truncated and Boot0004 is a vendor's
+				// variable, not a boot option.
+				BootEntries: []bootEntry{
+					{ID: "0000", Description: "ubuntu", Active: true},
+					{ID: "0001", Description: "UEFI: PXE IPv4 Intel(R) Ethernet Controller X710", Active: true},
+					{ID: "000A", Description: "EFI Internal Shell"},
+				},
+			},
+		},
+		{
+			// The SecureBoot variable is truncated, so its state is
+			// unknown.
+			fixture: "uefi-minimal",
+			want:    &firmware{Type: firmwareUEFI},
+		},
+		{
+			fixture: "bios",
+			want:    &firmware{Type: firmwareBIOS},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			useRoots(t, "testdata/firmware/"+test.fixture)
+			f, err := getFirmware()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(f, test.want) {
+				t.Errorf("getFirmware() =\n%+v\nwant\n%+v", f, test.want)
+			}
+		})
+	}
+}
+
+func TestParseLoadOption(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    bootEntry
+		wantErr bool
+	}{
+		{
+			name: "active",
+			data: []byte{1, 0, 0, 0, 4, 0, 'h', 0, 'd', 0, 0, 0, 0x7f, 0xff, 4, 0},
+			want: bootEntry{ID: "0002", Description: "hd", Active: true},
+		},
+		{
+			name: "inactive",
+			data: []byte{0, 0, 0, 0, 0, 0, 'h', 0, 'd', 0, 0, 0},
+			want: bootEntry{ID: "0002", Description: "hd"},
+		},
+		{
+			name: "unterminated",
+			data: []byte{1, 0, 0, 0, 0, 0, 'h', 0, 'd', 0},
+			want: bootEntry{ID: "0002", Description: "hd", Active: true},
+		},
+		{
+			name: "non-ascii",
+			data: []byte{1, 0, 0, 0, 0, 0, 0xe9, 0, 0x3d, 0xd8, 0x80, 0xde, 0, 0},
+			want: bootEntry{ID: "0002", Description: "é\U0001f680", Active: true},
+		},
+		{
+			name: "empty description",
+			data: []byte{1, 0, 0, 0, 0, 0},
+			want: bootEntry{ID: "0002", Active: true},
+		},
+		{
+			name:    "truncated",
+			data:    []byte{1, 0, 0, 0, 0},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry, err := parseLoadOption("0002", test.data)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("parseLoadOption() = %+v, want an error", entry)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry != test.want {
+				t.Errorf("parseLoadOption() = %+v, want %+v", entry, test.want)
+			}
+		})
+	}
+}
+
+func TestParseBootNumbers(t *testing.T) {
+	// A trailing odd byte isn't a boot number.
+	ids := parseBootNumbers([]byte{0x01, 0x00, 0xa0, 0x00, 0x34, 0x12, 0x05})
+	if want := []string{"0001", "00A0", "1234"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("parseBootNumbers() = %v, want %v", ids, want)
+	}
+	if ids := parseBootNumbers(nil); ids != nil {
+		t.Errorf("parseBootNumbers(nil) = %v, want nil", ids)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lxc/lxd/lxd/resources"
+	"github.com/lxc/lxd/shared/api"
+)
+
+// gpu is the LXD GPU information, with driver details added to each card.
+type gpu struct {
+	Cards []gpuCard `json:"cards" yaml:"cards"`
+	Total uint64    `json:"total" yaml:"total"`
+}
+
+type gpuCard struct {
+	api.ResourcesGPUCard `yaml:",inline"`
+	ComputeCapability    string `json:"compute_capability,omitempty" yaml:"compute_capability,omitempty"`
+}
+
+// nvidiaGPU is what nvidia-smi reports about a card.
+type nvidiaGPU struct {
+	driverVersion     string
+	computeCapability string
+}
+
+// normalizePCIAddress turns the address nvidia-smi reports, such as
+// "00000000:3B:00.0", into the "0000:3b:00.0" form sysfs uses.
+func normalizePCIAddress(address string) string {
+	address = strings.ToLower(strings.TrimSpace(address))
+	if domain, rest, found := strings.Cut(address, ":"); found && len(domain) > 4 {
+		address = domain[len(domain)-4:] + ":" + rest
+	}
+	return address
+}
+
+// parseNvidiaSMI parses the output of `nvidia-smi
+// --query-gpu=pci.bus_id,driver_version,compute_cap --format=csv,noheader`,
+// keyed by PCI address.
+func parseNvidiaSMI(data []byte) map[string]nvidiaGPU {
+	gpus := make(map[string]nvidiaGPU)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 {
+			continue
+		}
+		info := nvidiaGPU{
+			driverVersion:     strings.TrimSpace(fields[1]),
+			computeCapability: strings.TrimSpace(fields[2]),
+		}
+		// Older drivers don't know about compute_cap.
+		if strings.HasPrefix(info.computeCapability, "[") {
+			info.computeCapability = ""
+		}
+		gpus[normalizePCIAddress(fields[0])] = info
+	}
+	return gpus
+}
+
+// addGPUDriverDetails fills in each card's driver from sysfs, and driver
+// version and compute capability from nvidia-smi, where LXD didn't.
+func addGPUDriverDetails(cards []gpuCard, run commandRunner) {
+	var nvidia map[string]nvidiaGPU
+	data, err := run(
+		"nvidia-smi", "--query-gpu=pci.bus_id,driver_version,compute_cap",
+		"--format=csv,noheader")
+	if err == nil {
+		nvidia = parseNvidiaSMI(data)
+	}
+	for i := range cards {
+		card := &cards[i]
+		if card.PCIAddress == "" {
+			continue
+		}
+		if card.Driver == "" {
+			target, err := os.Readlink(
+				sysfsPath("bus/pci/devices", card.PCIAddress, "driver"))
+			if err == nil {
+				card.Driver = filepath.Base(target)
+			}
+		}
+		if info, ok := nvidia[card.PCIAddress]; ok {
+			if card.DriverVersion == "" {
+				card.DriverVersion = info.driverVersion
+			}
+			card.ComputeCapability = info.computeCapability
+		}
+		// In-tree drivers such as amdgpu only sometimes have a version.
+		if card.DriverVersion == "" && card.Driver != "" {
+			card.DriverVersion, _ = readString(sysfsPath("module", card.Driver, "version"))
+		}
+	}
+}
+
+func getGPU(opts *collectOptions) (*gpu, error) {
+	lxdGPU, err := resources.GetGPU()
+	if err != nil {
+		return nil, err
+	}
+	g := &gpu{
+		Cards: make([]gpuCard, len(lxdGPU.Cards)),
+		Total: lxdGPU.Total,
+	}
+	for i, card := range lxdGPU.Cards {
+		g.Cards[i].ResourcesGPUCard = card
+	}
+	if opts.gpuExtended {
+		addGPUDriverDetails(g.Cards, opts.run)
+	}
+	return g, nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"testing"
+
+	"github.com/lxc/lxd/shared/api"
+)
+
+func TestAddGPUDriverDetails(t *testing.T) {
+	useRoots(t, "testdata/gpu")
+	run := fakeRunner(map[string]fakeCommand{
+		"nvidia-smi --query-gpu=pci.bus_id,driver_version,compute_cap --format=csv,noheader": {
+			readTestFile(t, "testdata/gpu/nvidia-smi.csv"), nil,
+		},
+	})
+	cards := []gpuCard{
+		{ResourcesGPUCard: api.ResourcesGPUCard{PCIAddress: "0000:3b:00.0"}},
+		{ResourcesGPUCard: api.ResourcesGPUCard{PCIAddress: "0000:af:00.0"}},
+		{ResourcesGPUCard: api.ResourcesGPUCard{PCIAddress: "0000:03:00.0"}},
+		// What LXD found is kept.
+		{ResourcesGPUCard: api.ResourcesGPUCard{PCIAddress: "0000:3b:00.0", Driver: "nouveau", DriverVersion: "1.3.1"}},
+		{},
+	}
+	addGPUDriverDetails(cards, run)
+	want := []struct{ driver, version, compute string }{
+		{"nvidia", "535.129.03", "8.6"},
+		{"nvidia", "535.129.03", ""},
+		{"amdgpu", "5.11.32.21.40", ""},
+		{"nouveau", "1.3.1", "8.6"},
+		{"", "", ""},
+	}
+	for i, card := range cards {
+		if card.Driver != want[i].driver || card.DriverVersion != want[i].version ||
+			card.ComputeCapability != want[i].compute {
+			t.Errorf("card %d = %s %s %s, want %s %s %s", i,
+				card.Driver, card.DriverVersion, card.ComputeCapability,
+				want[i].driver, want[i].version, want[i].compute)
+		}
+	}
+}
+
+// Without nvidia-smi, drivers still come from sysfs.
+func TestAddGPUDriverDetailsWithoutNvidiaSMI(t *testing.T) {
+	useRoots(t, "testdata/gpu")
+	cards := []gpuCard{{ResourcesGPUCard: api.ResourcesGPUCard{PCIAddress: "0000:3b:00.0"}}}
+	addGPUDriverDetails(cards, fakeRunner(nil))
+	if cards[0].Driver != "nvidia" || cards[0].DriverVersion != "" {
+		t.Errorf("card = %s %s, want the nvidia driver without a version", cards[0].Driver, cards[0].DriverVersion)
+	}
+}
+
+func TestNormalizePCIAddress(t *testing.T) {
+	for address, want := range map[string]string{
+		"00000000:3B:00.0":  "0000:3b:00.0",
+		"0000:3b:00.0":      "0000:3b:00.0",
+		" 00000001:AF:00.1": "0001:af:00.1",
+	} {
+		if got := normalizePCIAddress(address); got != want {
+			t.Errorf("normalizePCIAddress(%q) = %q, want %q", address, got, want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// machineIDPaths are where the systemd machine ID is looked for, in order.
+var machineIDPaths = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// identifiers are values that identify the machine across reinstalls.
+// product_uuid is only readable by root, so it's missing from reports run
+// as anyone else; like the others, it's omitted if it can't be read.
+type identifiers struct {
+	MachineID       string `json:"machine_id,omitempty" yaml:"machine_id,omitempty"`
+	ProductUUID     string `json:"product_uuid,omitempty" yaml:"product_uuid,omitempty"`
+	ChassisAssetTag string `json:"chassis_asset_tag,omitempty" yaml:"chassis_asset_tag,omitempty"`
+}
+
+// getIdentifiers reads the machine ID from the first of machineIDPaths that
+// has one, and the product UUID and asset tag from dmiDir. It returns nil if
+// none of them can be read, and calls denied with the name of each field
+// that couldn't be read for lack of permission.
+func getIdentifiers(machineIDPaths []string, dmiDir string, denied func(field string)) (*identifiers, error) {
+	ids := &identifiers{}
+	for _, path := range machineIDPaths {
+		// Images are built with "uninitialized" or an empty file, which
+		// systemd replaces on first boot.
+		id, err := readString(path)
+		if err == nil && id != "" && id != "uninitialized" {
+			ids.MachineID = id
+			break
+		}
+	}
+	if uuid, err := readString(filepath.Join(dmiDir, "product_uuid")); err == nil {
+		ids.ProductUUID = strings.ToLower(uuid)
+	} else if deniedPermission(nil, err) {
+		denied("product_uuid")
+	}
+	ids.ChassisAssetTag, _ = readString(filepath.Join(dmiDir, "chassis_asset_tag"))
+	if *ids == (identifiers{}) {
+		return nil, nil
+	}
+	return ids, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetIdentifiers(t *testing.T) {
+	const dir = "testdata/identifiers"
+	tests := []struct {
+		name   string
+		paths  []string
+		dmiDir string
+		want   *identifiers
+	}{
+		{
+			// /etc/machine-id hasn't been set up yet, so the D-Bus
+			// one is used.
+			name:   "uninitialized",
+			paths:  []string{dir + "/etc/machine-id", dir + "/var/lib/dbus/machine-id"},
+			dmiDir: dir + "/dmi",
+			want: &identifiers{
+				MachineID:       "4f0c5b5e2d6a4e0f9f6b2c8d7e1a3b5c",
+				ProductUUID:     "03000200-0400-0500-0006-000700080009",
+				ChassisAssetTag: "ASSET-0042",
+			},
+		},
+		{
+			name:   "empty",
+			paths:  []string{dir + "/etc/machine-id-empty", dir + "/missing"},
+			dmiDir: dir + "/dmi",
+			want: &identifiers{
+				ProductUUID:     "03000200-0400-0500-0006-000700080009",
+				ChassisAssetTag: "ASSET-0042",
+			},
+		},
+		{
+			name:   "none",
+			paths:  []string{dir + "/etc/machine-id"},
+			dmiDir: dir + "/dmi-unset",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ids, err := getIdentifiers(test.paths, test.dmiDir, func(field string) {
+				t.Errorf("%s reported as denied", field)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (ids == nil) != (test.want == nil) || ids != nil && *ids != *test.want {
+				t.Errorf("getIdentifiers() = %+v, want %+v", ids, test.want)
+			}
+		})
+	}
+}
+
+func TestGetIdentifiersPermissionDenied(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read files regardless of their mode")
+	}
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "product_uuid"), []byte("03000200-0400-0500-0006-000700080009\n"))
+	if err := os.Chmod(filepath.Join(dir, "product_uuid"), 0); err != nil {
+		t.Fatal(err)
+	}
+	r := &machineResources{}
+	ids, err := getIdentifiers(
+		[]string{"testdata/identifiers/var/lib/dbus/machine-id"}, dir, r.permissionDenied("identifiers"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (identifiers{MachineID: "4f0c5b5e2d6a4e0f9f6b2c8d7e1a3b5c"}); ids == nil || *ids != want {
+		t.Errorf("getIdentifiers() = %+v, want %+v", ids, want)
+	}
+	if len(r.RequiresRoot) != 1 || r.RequiresRoot[0] != "identifiers.product_uuid" {
+		t.Errorf("requires_root = %v, want [identifiers.product_uuid]", r.RequiresRoot)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// infinibandDevice is an RDMA device in /sys/class/infiniband. PCIAddress
+// matches the device's entry in the pci section.
+type infinibandDevice struct {
+	Name            string           `json:"name" yaml:"name"`
+	PCIAddress      string           `json:"pci_address,omitempty" yaml:"pci_address,omitempty"`
+	FirmwareVersion string           `json:"firmware_version,omitempty" yaml:"firmware_version,omitempty"`
+	BoardID         string           `json:"board_id,omitempty" yaml:"board_id,omitempty"`
+	NodeGUID        string           `json:"node_guid,omitempty" yaml:"node_guid,omitempty"`
+	Ports           []infinibandPort `json:"ports" yaml:"ports"`
+}
+
+// infinibandPort is one port of an RDMA device. Rate is as the kernel
+// reports it, such as "100 Gb/sec (4X EDR)", with RateGbps its number.
+type infinibandPort struct {
+	Port          uint64  `json:"port" yaml:"port"`
+	State         string  `json:"state" yaml:"state"`
+	PhysicalState string  `json:"physical_state,omitempty" yaml:"physical_state,omitempty"`
+	LinkLayer     string  `json:"link_layer,omitempty" yaml:"link_layer,omitempty"`
+	Rate          string  `json:"rate,omitempty" yaml:"rate,omitempty"`
+	RateGbps      float64 `json:"rate_gbps,omitempty" yaml:"rate_gbps,omitempty"`
+}
+
+// stripStateNumber removes the numeric code from a port state such as
+// "4: ACTIVE" or "5: LinkUp".
+func stripStateNumber(state string) string {
+	if _, name, found := strings.Cut(state, ":"); found {
+		return strings.TrimSpace(name)
+	}
+	return state
+}
+
+// getInfinibandPorts reads the ports of the device in dir, in port order.
+func getInfinibandPorts(dir string) []infinibandPort {
+	var ports []infinibandPort
+	for _, name := range listDir(filepath.Join(dir, "ports")) {
+		number, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		portDir := filepath.Join(dir, "ports", name)
+		port := infinibandPort{Port: number}
+		if state, err := readString(filepath.Join(portDir, "state")); err == nil {
+			port.State = stripStateNumber(state)
+		}
+		if state, err := readString(filepath.Join(portDir, "phys_state")); err == nil {
+			port.PhysicalState = stripStateNumber(state)
+		}
+		port.LinkLayer, _ = readString(filepath.Join(portDir, "link_layer"))
+		port.Rate, _ = readString(filepath.Join(portDir, "rate"))
+		if fields := strings.Fields(port.Rate); len(fields) > 0 {
+			port.RateGbps, _ = strconv.ParseFloat(fields[0], 64)
+		}
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+	return ports
+}
+
+// getInfiniband returns the RDMA devices on the machine, or nil if there
+// are none.
+func getInfiniband() ([]infinibandDevice, error) {
+	dirs, err := filepath.Glob(sysfsPath("class/infiniband/*"))
+	if err != nil {
+		return nil, err
+	}
+	var devices []infinibandDevice
+	for _, dir := range dirs {
+		device := infinibandDevice{Name: filepath.Base(dir)}
+		if target, err := os.Readlink(filepath.Join(dir, "device")); err == nil {
+			device.PCIAddress = filepath.Base(target)
+		}
+		device.FirmwareVersion, _ = readString(filepath.Join(dir, "fw_ver"))
+		device.BoardID, _ = readString(filepath.Join(dir, "board_id"))
+		device.NodeGUID, _ = readString(filepath.Join(dir, "node_guid"))
+		device.Ports = getInfinibandPorts(dir)
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetInfiniband(t *testing.T) {
+	useRoots(t, "testdata/infiniband")
+	devices, err := getInfiniband()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []infinibandDevice{
+		{
+			Name:            "mlx5_0",
+			PCIAddress:      "0000:3b:00.0",
+			FirmwareVersion: "16.35.2000",
+			BoardID:         "MT_0000000010",
+			NodeGUID:        "0c42:a103:0003:5d82",
+			Ports: []infinibandPort{
+				{
+					Port: 1, State: "ACTIVE", PhysicalState: "LinkUp",
+					LinkLayer: "InfiniBand", Rate: "100 Gb/sec (4X EDR)", RateGbps: 100,
+				},
+				{
+					Port: 2, State: "DOWN", PhysicalState: "Disabled",
+					LinkLayer: "Ethernet", Rate: "2.5 Gb/sec (1X SDR)", RateGbps: 2.5,
+				},
+			},
+		},
+		// Soft RoCE has no PCI device and reports little about its port.
+		{
+			Name:     "rxe0",
+			NodeGUID: "0000:0000:0000:0000",
+			Ports:    []infinibandPort{{Port: 1, State: "ACTIVE", LinkLayer: "Ethernet"}},
+		},
+	}
+	if !reflect.DeepEqual(devices, want) {
+		t.Errorf("getInfiniband() =\n%+v\nwant\n%+v", devices, want)
+	}
+}
+
+func TestGetInfinibandNone(t *testing.T) {
+	useRoots(t, "testdata/dmi-empty")
+	devices, err := getInfiniband()
+	if err != nil || devices != nil {
+		t.Errorf("getInfiniband() = %+v, %v; want nil, nil", devices, err)
+	}
+}
+
+func TestStripStateNumber(t *testing.T) {
+	tests := map[string]string{
+		"4: ACTIVE":   "ACTIVE",
+		"5: LinkUp":   "LinkUp",
+		"ACTIVE":      "ACTIVE",
+		"2:   INIT  ": "INIT",
+	}
+	for state, want := range tests {
+		if got := stripStateNumber(state); got != want {
+			t.Errorf("stripStateNumber(%q) = %q, want %q", state, got, want)
+		}
+	}
+}
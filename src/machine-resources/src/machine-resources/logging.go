@@ -0,0 +1,45 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// newLogger returns a logger writing to w at the given level, one of debug,
+// info, warn or error, as text or, if asJSON is set, as JSON lines.
+func newLogger(w io.Writer, level string, asJSON bool) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf(
+			"unknown log level %q (expected one of: debug, info, warn, error)", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	if asJSON {
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return slog.New(slog.NewTextHandler(w, opts)), nil
+}
+
+// loggingRunner wraps run so that each command it runs is logged at debug
+// level.
+func loggingRunner(logger *slog.Logger, run commandRunner) commandRunner {
+	return func(name string, args ...string) ([]byte, error) {
+		start := time.Now()
+		out, err := run(name, args...)
+		attrs := []any{
+			"command", strings.Join(append([]string{name}, args...), " "),
+			"duration", time.Since(start),
+		}
+		if err != nil {
+			attrs = append(attrs, "error", err)
+		}
+		logger.Debug("ran command", attrs...)
+		return out, err
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewLoggerUnknownLevel(t *testing.T) {
+	if _, err := newLogger(&bytes.Buffer{}, "loud", false); err == nil {
+		t.Fatal("newLogger() with an unknown level succeeded, want an error")
+	}
+}
+
+func TestNewLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "info", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("hidden")
+	logger.Info("shown", "subsystem", "cpu")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d log lines, want 1: %q", len(lines), buf.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["msg"] != "shown" || record["subsystem"] != "cpu" {
+		t.Errorf("logged %v, want msg shown and subsystem cpu", record)
+	}
+}
+
+func TestLoggingRunnerLogsCommands(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "debug", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := loggingRunner(logger, func(name string, args ...string) ([]byte, error) {
+		return nil, errors.New("exit status 1")
+	})
+	if _, err := run("smartctl", "--json", "/dev/sda"); err == nil {
+		t.Fatal("the runner's error was dropped")
+	}
+	for _, want := range []string{`command="smartctl --json /dev/sda"`, `error="exit status 1"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log %q doesn't contain %s", buf.String(), want)
+		}
+	}
+}
+
+// Retries were printed to stderr before --log-level existed, and still must
+// be at its default level.
+func TestRetriesLoggedAtDefaultLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "error", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures := 1
+	selected := []subsystem{{"flaky", false, func(r *machineResources, opts *collectOptions) error {
+		if failures > 0 {
+			failures--
+			return errors.New("device busy")
+		}
+		return nil
+	}}}
+	opts := &collectOptions{logger: logger, retries: 1}
+	if _, ok := collectSubsystems(context.Background(), selected, opts); !ok {
+		t.Fatal("collection failed")
+	}
+	if !strings.Contains(buf.String(), "retrying") || !strings.Contains(buf.String(), "device busy") {
+		t.Errorf("log %q doesn't report the retry", buf.String())
+	}
+}
@@ -4,25 +4,571 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/lxc/lxd/lxd/resources"
+	"gopkg.in/yaml.v2"
 )
 
+// Exit codes, so that callers can tell bad usage from a failed collection.
+const (
+	exitFailure      = 1
+	exitUsage        = 2
+	exitDiffers      = 3   // --diff found changes.
+	exitInvalid      = 4   // --validate found problems.
+	exitBadSignature = 5   // --verify found a bad signature.
+	exitImplausible  = 6   // --self-test failed a check.
+	exitTimeout      = 124 // As coreutils' timeout(1).
+)
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "unknown"
+
+// lxdRevision is the LXD revision in Gopkg.lock, set at build time with
+// -ldflags "-X main.lxdRevision=...", since a GOPATH build records no
+// module versions.
+var lxdRevision = ""
+
+// lxdVersion returns the LXD revision or module version the binary was
+// built against, if the build recorded either.
+func lxdVersion() string {
+	if lxdRevision != "" {
+		return lxdRevision
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == "github.com/lxc/lxd" {
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
+
+// printVersion writes what --version reports to w.
+func printVersion(w io.Writer) {
+	fmt.Fprintf(w, "machine-resources %s\n", version)
+	fmt.Fprintf(w, "lxd resources %s\n", lxdVersion())
+	fmt.Fprintf(w, "%s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// apiVersion is the version of the envelope the report is wrapped in. Bump
+// it whenever the envelope's structure changes incompatibly; adding optional
+// fields doesn't need a bump.
+const apiVersion = 1
+
+// envelope wraps the report so that consumers know which shape to expect.
+// Signature is set by --sign when the report goes to stdout.
+type envelope struct {
+	APIVersion  int               `json:"api_version" yaml:"api_version"`
+	Fingerprint string            `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	Signature   string            `json:"signature,omitempty" yaml:"signature,omitempty"`
+	Resources   *machineResources `json:"resources" yaml:"resources"`
+}
+
+// marshalers maps each supported --format value to its encoder.
+var marshalers = map[string]func(interface{}) ([]byte, error){
+	"json": func(v interface{}) ([]byte, error) {
+		return json.MarshalIndent(v, "", "    ")
+	},
+	"json-compact": json.Marshal,
+	"prometheus":   marshalPrometheus,
+	"yaml":         yaml.Marshal,
+}
+
+// yamlViaJSON returns what v marshals to as JSON in a form yaml.v2
+// marshals the same way, for the MarshalYAML methods of types that shadow
+// fields of an inlined struct.
+func yamlViaJSON(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decodeOrderedJSON(decoder)
+}
+
+// decodeOrderedJSON decodes the next JSON value from decoder into something
+// yaml.v2 marshals the same way as the struct it came from: objects become
+// yaml.MapSlice, keeping their keys in order, and numbers become integers
+// where they can. The decoder must be set to UseNumber.
+func decodeOrderedJSON(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '[' {
+			items := []interface{}{}
+			for decoder.More() {
+				item, err := decodeOrderedJSON(decoder)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			_, err := decoder.Token()
+			return items, err
+		}
+		object := yaml.MapSlice{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, yaml.MapItem{Key: key, Value: value})
+		}
+		_, err := decoder.Token()
+		return object, err
+	case json.Number:
+		if i, err := strconv.ParseInt(token.String(), 10, 64); err == nil {
+			return i, nil
+		}
+		if u, err := strconv.ParseUint(token.String(), 10, 64); err == nil {
+			return u, nil
+		}
+		return token.Float64()
+	}
+	return token, nil
+}
+
+// formatMarshaler returns the encoder for format, leaving JSON unindented
+// unless pretty is set. Other formats look the same either way.
+func formatMarshaler(format string, pretty bool) (func(interface{}) ([]byte, error), bool) {
+	if format == "json" && !pretty {
+		return json.Marshal, true
+	}
+	marshal, ok := marshalers[format]
+	return marshal, ok
+}
+
+func formatNames() string {
+	names := make([]string, 0, len(marshalers))
+	for name := range marshalers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// writeFile writes data to path, creating it if needed. The file is synced
+// before closing and removed again on failure so that a partial report is
+// never left behind.
+func writeFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// stringList is a flag that can be repeated, and whose values may also be
+// comma separated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
 func main() {
-	resources, err := resources.GetResources()
+	var include, exclude stringList
+	var output string
+	format := flag.String(
+		"format", "json", "output format, one of: "+formatNames())
+	flag.StringVar(&output, "output", "", "write output to `path` instead of stdout")
+	flag.StringVar(&output, "o", "", "shorthand for --output")
+	bare := flag.Bool(
+		"bare", false, "emit the resources without the versioned envelope")
+	query := flag.String(
+		"select", "", "print only the value at a dotted `path`, such as memory.total")
+	compression := flag.String(
+		"compress", "", "compress the output, with one of: "+compressorNames())
+	stream := flag.Bool(
+		"stream", false, "write each subsystem as a JSON line as soon as it's collected")
+	timeout := flag.Duration(
+		"timeout", 0, "give up collecting after this long (default no timeout)")
+	flag.Var(&include, "include", "only collect this `subsystem` (repeatable)")
+	flag.Var(&exclude, "exclude", "don't collect this `subsystem` (repeatable)")
+	redact := flag.Bool(
+		"redact", false, "replace serial numbers, MAC addresses, UUIDs and other identifiers with salted hashes")
+	redactSalt := flag.String(
+		"redact-salt", "", "`salt` for --redact (default random for each run, and then nothing is cached)")
+	flag.StringVar(
+		&sysfsRoot, "sysfs-root", envOr("MAAS_SYSFS_ROOT", sysfsRoot),
+		"read sysfs from `path` (overrides MAAS_SYSFS_ROOT)")
+	flag.StringVar(
+		&procRoot, "proc-root", envOr("MAAS_PROC_ROOT", procRoot),
+		"read procfs from `path` (overrides MAAS_PROC_ROOT)")
+	pretty := flag.Bool("pretty", true, "indent json output")
+	noPretty := flag.Bool("no-pretty", false, "shorthand for --pretty=false")
+	var opts collectOptions
+	flag.BoolVar(
+		&opts.smart, "smart", false, "add SMART health data from smartctl to disks (needs root)")
+	flag.BoolVar(
+		&opts.dimms, "dimms", false, "add memory modules from dmidecode (needs root)")
+	flag.BoolVar(
+		&opts.gpuExtended, "gpu-extended", false, "add GPU driver versions and compute capability")
+	flag.BoolVar(
+		&opts.sensors, "sensors", false, "add hwmon temperature and fan readings")
+	flag.BoolVar(
+		&opts.hardwareRAID, "hardware-raid", false,
+		"add RAID volumes from storcli or megacli (needs root)")
+	flag.BoolVar(
+		&opts.bmc, "bmc", false, "add BMC firmware and LAN details from ipmitool (needs root)")
+	flag.StringVar(
+		&opts.pluginDir, "plugin-dir", "", "run the executables in `dir` and add their JSON output")
+	diffPath := flag.String(
+		"diff", "", "report only the differences from the report saved at `path`")
+	diffAll := flag.Bool(
+		"diff-all", false, "don't ignore volatile fields with --diff")
+	flag.IntVar(
+		&opts.retries, "retries", 0, "retry a failed subsystem up to `n` times")
+	flag.DurationVar(
+		&opts.retryDelay, "retry-delay", time.Second, "how long to wait before each retry")
+	remote := flag.String(
+		"remote", "", "collect on `user@host` over SSH instead of locally")
+	identity := flag.String(
+		"identity", "", "SSH private key `file` for --remote (default use the SSH agent)")
+	validate := flag.Bool(
+		"validate", false, "check the resources against the schema before emitting them")
+	useCache := flag.Bool(
+		"cache", false, "reuse the resources cached by a recent run, and cache them otherwise")
+	noCache := flag.Bool(
+		"no-cache", false, "collect afresh even with --cache, then update the cache")
+	cache := &resultCache{now: time.Now}
+	flag.DurationVar(
+		&cache.ttl, "cache-ttl", 5*time.Minute, "how long cached resources are reused for")
+	flag.StringVar(
+		&cache.path, "cache-path", defaultCachePath, "`path` of the cache file")
+	signKey := flag.String(
+		"sign", "", "sign the report with the Ed25519 private key at `path`")
+	verifyKey := flag.String(
+		"verify", "", "check the signature of the report given as the argument, "+
+			"which may be compressed, with the Ed25519 public key at `path`, and exit")
+	selfTestMode := flag.Bool(
+		"self-test", false, "check that the resources are plausible, reporting on stderr, and exit")
+	archReport := flag.Bool(
+		"arch-report", false, "add the architecture and the subsystems known not to work on it")
+	var profile profileFlag
+	flag.Var(
+		&profile, "profile", "time each subsystem, reporting milliseconds in _timings, "+
+			"or on stderr with --profile=stderr")
+	logLevel := flag.String(
+		"log-level", "error", "log to stderr at this level, one of: debug, info, warn, error")
+	logJSON := flag.Bool("log-json", false, "write logs as JSON lines")
+	errorFormat := flag.String(
+		"error-format", "text", "how to write errors to stderr, one of: json, text")
+	showVersion := flag.Bool("version", false, "print version information and exit")
+	flag.Parse()
+
+	if *showVersion {
+		printVersion(os.Stdout)
+		return
+	}
+
+	reporter, err := newErrorReporter(*errorFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	logger, err := newLogger(os.Stderr, *logLevel, *logJSON)
+	if err != nil {
+		reporter.fatal("", err, exitUsage)
+	}
+	if *verifyKey != "" {
+		if flag.NArg() != 1 {
+			reporter.fatal("", errors.New("--verify needs the report to check as its argument"), exitUsage)
+		}
+		key, err := loadVerifyingKey(*verifyKey)
+		if err != nil {
+			reporter.fatal("", err, exitUsage)
+		}
+		if err := verifyReport(key, flag.Arg(0)); err == errBadSignature {
+			reporter.fatal("", err, exitBadSignature)
+		} else if err != nil {
+			reporter.fatal("", err, exitFailure)
+		}
+		return
+	}
+	marshal, ok := formatMarshaler(*format, *pretty && !*noPretty)
+	if !ok {
+		reporter.fatal("", fmt.Errorf(
+			"unknown format %q (expected one of: %s)",
+			*format, formatNames()), exitUsage)
+	}
+	if _, ok := compressors[*compression]; !ok && *compression != "" {
+		reporter.fatal("", fmt.Errorf(
+			"unknown compression %q (expected one of: %s)",
+			*compression, compressorNames()), exitUsage)
+	}
+	if *remote != "" {
+		if err := checkRemoteFlags(flag.CommandLine); err != nil {
+			reporter.fatal("", err, exitUsage)
+		}
+		var stdout bytes.Buffer
+		code, err := runRemote(
+			*remote, *identity, remoteArgs(flag.CommandLine), &stdout, os.Stderr)
+		if err != nil {
+			reporter.fatal("", err, exitFailure)
+		}
+		if output == "" {
+			os.Stdout.Write(stdout.Bytes())
+		} else if err := writeFile(output, stdout.Bytes()); err != nil {
+			reporter.fatal("", err, exitFailure)
+		}
+		os.Exit(code)
+	}
+	if *query != "" && *diffPath != "" {
+		reporter.fatal("", errors.New("--select can't be used with --diff"), exitUsage)
+	}
+	if *stream && (output != "" || *diffPath != "" || *query != "" ||
+		*signKey != "" || *validate || *compression != "" ||
+		!strings.HasPrefix(*format, "json")) {
+		reporter.fatal("", errors.New(
+			"--stream writes JSON lines to stdout, and can't be used with --output, "+
+				"--diff, --select, --sign, --validate, --compress or another format"), exitUsage)
+	}
+	var signingKey ed25519.PrivateKey
+	if *signKey != "" {
+		if !strings.HasPrefix(*format, "json") || *query != "" || *diffPath != "" {
+			reporter.fatal("", errors.New(
+				"--sign needs a JSON format and can't be used with --select or --diff"), exitUsage)
+		}
+		if *bare && output == "" {
+			reporter.fatal("", errors.New(
+				"--sign with --bare needs --output to write the signature next to"), exitUsage)
+		}
+		signingKey, err = loadSigningKey(*signKey)
+		if err != nil {
+			reporter.fatal("", err, exitUsage)
+		}
+	}
+	selected, err := selectSubsystems(include, exclude)
 	if err != nil {
-		fmt.Printf("error: %v\n", err)
-		os.Exit(1)
+		reporter.fatal("", err, exitUsage)
+	}
+	var baseline interface{}
+	if *diffPath != "" {
+		baseline, err = loadBaseline(*diffPath)
+		if err != nil {
+			reporter.fatal("", err, exitUsage)
+		}
 	}
 
-	data, err := json.MarshalIndent(resources, "", "    ")
+	var rd *redactor
+	if *redact {
+		rd, err = newRedactor(*redactSalt)
+		if err != nil {
+			reporter.fatal("", err, exitFailure)
+		}
+	}
+	var sw *streamWriter
+	if *stream {
+		sw = &streamWriter{w: os.Stdout, rd: rd}
+		opts.collected = func(name string, r *machineResources, collectErr error) {
+			if err := sw.write(name, r, collectErr); err != nil {
+				reporter.report(name, err, 0)
+			}
+		}
+	}
+
+	if profile != profileOff {
+		opts.timings = make(map[string]time.Duration)
+	}
+	opts.run = loggingRunner(logger, runCommand)
+	opts.logger = logger
+	asRoot := os.Geteuid() == 0
+	logger.Debug("privileges", "root", asRoot)
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	// A random salt redacts differently on every run, so there'd be
+	// nothing to reuse.
+	var caching *resultCache
+	if *useCache && (rd == nil || *redactSalt != "") {
+		caching = cache
+	}
+	// Streaming is for seeing results as they come, so it always collects.
+	collected, err := cachedCollection(ctx, selected, &opts, caching, !*noCache && !*stream, rd)
+	if err == context.DeadlineExceeded {
+		// The collection may still be going in the background, and
+		// mustn't stream more after the timeout is reported.
+		if sw != nil {
+			sw.stop()
+		}
+		reporter.fatal("", fmt.Errorf("timed out after %s", *timeout), exitTimeout)
+	} else if err != nil {
+		reporter.fatal("", err, exitFailure)
+	}
+	if collected.storeErr != nil {
+		reporter.report("", fmt.Errorf("can't cache resources: %v", collected.storeErr), 0)
+	}
+	resources, cached, complete := collected.resources, collected.cached, collected.complete
+	// Timings are added after caching, so that they're never stale.
+	if !cached && profile == profileReport {
+		resources.Timings = millisecondTimings(opts.timings)
+	} else if !cached && profile == profileStderr {
+		data, _ := json.Marshal(map[string]interface{}{
+			"_timings": millisecondTimings(opts.timings),
+		})
+		fmt.Fprintf(os.Stderr, "%s\n", data)
+	}
+	if *archReport {
+		resources.Architecture = runtime.GOARCH
+		resources.UnsupportedSubsystems = unsupportedSubsystems(runtime.GOARCH, selected)
+	}
+	for _, s := range selected {
+		if msg, failed := resources.Errors[s.name]; failed && s.core {
+			reporter.report(s.name, errors.New(msg), exitFailure)
+		}
+	}
+	if !asRoot && len(resources.RequiresRoot) > 0 {
+		reporter.warn(fmt.Sprintf(
+			"not running as root, so these are incomplete: %s; run as root for a full report",
+			strings.Join(resources.RequiresRoot, ", ")))
+	}
+
+	if *selfTestMode {
+		if !selfTest(os.Stderr, sanityChecks, resources, selected) {
+			os.Exit(exitImplausible)
+		}
+		return
+	}
+
+	if *stream {
+		if !complete {
+			os.Exit(exitFailure)
+		}
+		return
+	}
+
+	if *validate {
+		problems, err := validateResources(resources)
+		if err != nil {
+			reporter.fatal("", err, exitFailure)
+		}
+		for _, problem := range problems {
+			reporter.report("", errors.New(problem), exitInvalid)
+		}
+		if len(problems) > 0 {
+			os.Exit(exitInvalid)
+		}
+	}
+
+	var report interface{} = resources
+	var changes []change
+	if baseline != nil {
+		changes, err = diffResources(baseline, resources, *diffAll)
+		if err != nil {
+			reporter.fatal("", err, exitFailure)
+		}
+		report = &diffReport{Changes: changes}
+	} else if !*bare && *query == "" {
+		report = &envelope{
+			APIVersion:  apiVersion,
+			Fingerprint: collected.fingerprint,
+			Resources:   resources,
+		}
+	}
+	// The signature covers everything emitted but itself, so it's made once
+	// the report is redacted and wrapped.
+	var signature string
+	if signingKey != nil {
+		signature, err = signReport(signingKey, report)
+		if err != nil {
+			reporter.fatal("", err, exitFailure)
+		}
+		// With --output the signature goes in a detached file instead.
+		if env, ok := report.(*envelope); ok && output == "" {
+			env.Signature = signature
+		}
+	}
+	var data []byte
+	if *query != "" {
+		var value interface{}
+		value, err = selectPath(resources, *query)
+		if err != nil {
+			reporter.fatal("", err, exitUsage)
+		}
+		// Anything other than a scalar is written as JSON, whatever the
+		// format.
+		if !strings.HasPrefix(*format, "json") {
+			marshal = marshalers["json"]
+		}
+		data, err = formatSelected(value, marshal)
+	} else {
+		data, err = marshal(report)
+	}
 	if err != nil {
-		fmt.Printf("error: %v\n", err)
-		os.Exit(1)
+		reporter.fatal("", err, exitFailure)
 	}
 
-	fmt.Printf("%s\n", data)
+	data = append(bytes.TrimSuffix(data, []byte("\n")), '\n')
+	if *compression != "" {
+		data, err = compress(*compression, data)
+		if err != nil {
+			reporter.fatal("", err, exitFailure)
+		}
+	}
+	if output == "" {
+		os.Stdout.Write(data)
+	} else if err := writeFile(output, data); err != nil {
+		reporter.fatal("", err, exitFailure)
+	} else if signature != "" {
+		if err := writeFile(output+".sig", []byte(signature+"\n")); err != nil {
+			reporter.fatal("", err, exitFailure)
+		}
+	}
+	if !complete {
+		os.Exit(exitFailure)
+	}
+	if len(changes) > 0 {
+		os.Exit(exitDiffers)
+	}
 }
@@ -0,0 +1,177 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestMarshalers(t *testing.T) {
+	report := &envelope{
+		APIVersion: apiVersion,
+		Resources:  &machineResources{Virt: &virtualization{Type: "vm", Hypervisor: "kvm"}},
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"json", "{\n    \"api_version\": 1,\n    \"resources\": {\n        \"virtualization\": {\n" +
+			"            \"type\": \"vm\",\n            \"hypervisor\": \"kvm\"\n        }\n    }\n}"},
+		{"json-compact", `{"api_version":1,"resources":{"virtualization":{"type":"vm","hypervisor":"kvm"}}}`},
+		{"yaml", "api_version: 1\nresources:\n  virtualization:\n    type: vm\n    hypervisor: kvm\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			data, err := marshalers[test.format](report)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", data, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeOrderedJSON(t *testing.T) {
+	decoder := json.NewDecoder(strings.NewReader(
+		`{"b": 1, "a": [2.5, "x", null], "c": 18446744073709551615, "d": {}}`))
+	decoder.UseNumber()
+	got, err := decodeOrderedJSON(decoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := yaml.MapSlice{
+		{Key: "b", Value: int64(1)},
+		{Key: "a", Value: []interface{}{2.5, "x", nil}},
+		{Key: "c", Value: uint64(18446744073709551615)},
+		{Key: "d", Value: yaml.MapSlice{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeOrderedJSON() = %#v, want %#v", got, want)
+	}
+}
+
+func TestFormatMarshaler(t *testing.T) {
+	v := map[string]int{"cores": 4}
+	tests := []struct {
+		format string
+		pretty bool
+		want   string
+	}{
+		{"json", true, "{\n    \"cores\": 4\n}"},
+		{"json", false, `{"cores":4}`},
+		{"json-compact", true, `{"cores":4}`},
+		{"yaml", false, "cores: 4\n"},
+	}
+	for _, test := range tests {
+		marshal, ok := formatMarshaler(test.format, test.pretty)
+		if !ok {
+			t.Fatalf("formatMarshaler(%q) found no encoder", test.format)
+		}
+		data, err := marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.want {
+			t.Errorf("%s with pretty %t = %q, want %q", test.format, test.pretty, data, test.want)
+		}
+	}
+	if _, ok := formatMarshaler("xml", true); ok {
+		t.Error("formatMarshaler() found an encoder for an unknown format")
+	}
+}
+
+func TestFormatNames(t *testing.T) {
+	if got, want := formatNames(), "json, json-compact, prometheus, yaml"; got != want {
+		t.Errorf("formatNames() = %q, want %q", got, want)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resources.json")
+	writeTestFile(t, path, []byte("an older, longer report"))
+	if err := writeFile(path, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "{}" {
+		t.Errorf("wrote %q, want %q", data, "{}")
+	}
+}
+
+func TestWriteFileMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resources.json")
+	if err := writeFile(path, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("created %s with mode %o, want 600", path, mode)
+	}
+}
+
+func TestWriteFileMissingDir(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "resources.json")
+	if err := writeFile(path, []byte("{}")); err == nil {
+		t.Errorf("writeFile(%q) succeeded", path)
+	}
+}
+
+func TestPrintVersion(t *testing.T) {
+	defer func(old string) { version = old }(version)
+	version = "2.7.0-8000-g.abcdef"
+	var buf bytes.Buffer
+	printVersion(&buf)
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("printed %q, want 3 lines", buf.String())
+	}
+	if want := "machine-resources 2.7.0-8000-g.abcdef"; lines[0] != want {
+		t.Errorf("line 1 = %q, want %q", lines[0], want)
+	}
+	if !strings.HasPrefix(lines[1], "lxd resources ") {
+		t.Errorf("line 2 = %q, want the LXD version", lines[1])
+	}
+	if want := fmt.Sprintf("%s %s/%s", runtime.Version(), runtime.GOOS, runtime.GOARCH); lines[2] != want {
+		t.Errorf("line 3 = %q, want %q", lines[2], want)
+	}
+}
+
+func TestLXDVersionRevision(t *testing.T) {
+	defer func(old string) { lxdRevision = old }(lxdRevision)
+	lxdRevision = "bd7e2ec94c4f44ad96edf09cc4a3125c24e5301c"
+	if got := lxdVersion(); got != lxdRevision {
+		t.Errorf("lxdVersion() = %q, want the revision from the build, %q", got, lxdRevision)
+	}
+}
+
+func TestStringList(t *testing.T) {
+	var l stringList
+	for _, value := range []string{"cpu, memory", "storage", ",,"} {
+		if err := l.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := "cpu,memory,storage"; l.String() != want {
+		t.Errorf("got %q, want %q", l.String(), want)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/lxc/lxd/lxd/resources"
+	"github.com/lxc/lxd/shared/api"
+)
+
+// memory is the LXD memory information, with the installed modules added.
+type memory struct {
+	api.ResourcesMemory `yaml:",inline"`
+	Modules             []memoryModule `json:"modules,omitempty" yaml:"modules,omitempty"`
+}
+
+// memoryModule is a memory slot, from an SMBIOS type 17 (memory device)
+// structure. Empty slots are reported with Populated false. Speeds are in
+// MT/s; ConfiguredSpeedMTs below SpeedMTs means the module is downclocked.
+type memoryModule struct {
+	Slot               string `json:"slot" yaml:"slot"`
+	SizeBytes          uint64 `json:"size_bytes" yaml:"size_bytes"`
+	SpeedMTs           uint64 `json:"speed_mts,omitempty" yaml:"speed_mts,omitempty"`
+	ConfiguredSpeedMTs uint64 `json:"configured_speed_mts,omitempty" yaml:"configured_speed_mts,omitempty"`
+	Manufacturer       string `json:"manufacturer,omitempty" yaml:"manufacturer,omitempty"`
+	PartNumber         string `json:"part_number,omitempty" yaml:"part_number,omitempty"`
+	Populated          bool   `json:"populated" yaml:"populated"`
+}
+
+var dmidecodeSizeUnits = map[string]uint64{
+	"bytes": 1,
+	"kB":    1 << 10,
+	"MB":    1 << 20,
+	"GB":    1 << 30,
+	"TB":    1 << 40,
+}
+
+// parseDMIDecodeSize parses a size such as "16384 MB" or "16 GB".
+func parseDMIDecodeSize(value string) (uint64, bool) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return 0, false
+	}
+	size, err := strconv.ParseUint(fields[0], 10, 64)
+	unit, known := dmidecodeSizeUnits[fields[1]]
+	if err != nil || !known {
+		return 0, false
+	}
+	return size * unit, true
+}
+
+// parseDMIDecodeSpeed parses a speed such as "2666 MT/s", or "2666 MHz" as
+// older dmidecode versions put it.
+func parseDMIDecodeSpeed(value string) uint64 {
+	fields := strings.Fields(value)
+	if len(fields) != 2 || (fields[1] != "MT/s" && fields[1] != "MHz") {
+		return 0
+	}
+	speed, _ := strconv.ParseUint(fields[0], 10, 64)
+	return speed
+}
+
+// dmidecodeValue returns value unless it's one of the placeholders
+// dmidecode uses for missing information.
+func dmidecodeValue(value string) string {
+	switch value {
+	case "Unknown", "Not Specified", "NO DIMM", "[Empty]":
+		return ""
+	}
+	return value
+}
+
+// parseDMIDecodeMemory parses the memory devices in `dmidecode -t memory`
+// output.
+func parseDMIDecodeMemory(data []byte) []memoryModule {
+	var modules []memoryModule
+	var module *memoryModule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Handle ") {
+			if module != nil {
+				modules = append(modules, *module)
+				module = nil
+			}
+			if strings.Contains(line, "DMI type 17,") {
+				module = &memoryModule{}
+			}
+			continue
+		}
+		// Values are indented by one tab; lists under a key by two.
+		if module == nil || !strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "\t\t") {
+			continue
+		}
+		key, value, found := strings.Cut(strings.TrimSpace(line), ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Locator":
+			module.Slot = value
+		case "Size":
+			module.SizeBytes, module.Populated = parseDMIDecodeSize(value)
+		case "Speed":
+			module.SpeedMTs = parseDMIDecodeSpeed(value)
+		case "Configured Memory Speed", "Configured Clock Speed":
+			module.ConfiguredSpeedMTs = parseDMIDecodeSpeed(value)
+		case "Manufacturer":
+			module.Manufacturer = dmidecodeValue(value)
+		case "Part Number":
+			module.PartNumber = dmidecodeValue(value)
+		}
+	}
+	if module != nil {
+		modules = append(modules, *module)
+	}
+	return modules
+}
+
+// getMemoryModules returns the memory modules reported by dmidecode, or nil
+// if it isn't available or can't read SMBIOS, which needs root.
+func getMemoryModules(run commandRunner) []memoryModule {
+	data, err := run("dmidecode", "--type", "memory")
+	if err != nil {
+		return nil
+	}
+	return parseDMIDecodeMemory(data)
+}
+
+func getMemory(opts *collectOptions) (*memory, error) {
+	lxdMemory, err := resources.GetMemory()
+	if err != nil {
+		return nil, err
+	}
+	m := &memory{ResourcesMemory: *lxdMemory}
+	if opts.dimms {
+		m.Modules = getMemoryModules(opts.run)
+	}
+	return m, nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetMemoryModules(t *testing.T) {
+	run := fakeRunner(map[string]fakeCommand{
+		"dmidecode --type memory": {readTestFile(t, "testdata/memory/dmidecode.txt"), nil},
+	})
+	want := []memoryModule{
+		{
+			Slot: "A1", SizeBytes: 32 << 30, SpeedMTs: 2933, ConfiguredSpeedMTs: 2666,
+			Manufacturer: "00AD00B300AD", PartNumber: "HMA84GR7CJR4N-WM", Populated: true,
+		},
+		{
+			Slot: "A2", SizeBytes: 16384 << 20, SpeedMTs: 2666, ConfiguredSpeedMTs: 2666,
+			Manufacturer: "Samsung", PartNumber: "M393A2K43BB1-CTD", Populated: true,
+		},
+		{Slot: "A3"},
+	}
+	if got := getMemoryModules(run); !reflect.DeepEqual(got, want) {
+		t.Errorf("getMemoryModules() = %+v, want %+v", got, want)
+	}
+}
+
+// dmidecode needs root to read SMBIOS.
+func TestGetMemoryModulesDenied(t *testing.T) {
+	run := fakeRunner(map[string]fakeCommand{
+		"dmidecode --type memory": {nil, exitError(t, 1, "/sys/firmware/dmi/tables/smbios_entry_point: Permission denied\n")},
+	})
+	if got := getMemoryModules(run); got != nil {
+		t.Errorf("getMemoryModules() = %+v, want nil", got)
+	}
+}
+
+func TestParseDMIDecodeSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  uint64
+		ok    bool
+	}{
+		{"16 GB", 16 << 30, true},
+		{"8192 MB", 8 << 30, true},
+		{"1 TB", 1 << 40, true},
+		{"No Module Installed", 0, false},
+		{"16 GiB", 0, false},
+	}
+	for _, test := range tests {
+		got, ok := parseDMIDecodeSize(test.value)
+		if got != test.want || ok != test.ok {
+			t.Errorf("parseDMIDecodeSize(%q) = %d, %t; want %d, %t", test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
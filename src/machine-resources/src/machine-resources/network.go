@@ -0,0 +1,191 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lxc/lxd/lxd/resources"
+	"github.com/lxc/lxd/shared/api"
+)
+
+// Interface types, as reported in network.interfaces.*.type.
+const (
+	ifacePhysical = "physical"
+	ifaceBond     = "bond"
+	ifaceBridge   = "bridge"
+	ifaceVLAN     = "vlan"
+	ifaceOther    = "other"
+)
+
+// network is the LXD network information, which only covers physical
+// cards, with every interface and how they're related added.
+type network struct {
+	api.ResourcesNetwork `yaml:",inline"`
+	Interfaces           []networkInterface `json:"interfaces,omitempty" yaml:"interfaces,omitempty"`
+}
+
+// networkInterface is a network interface and its place in the bond, bridge
+// and VLAN topology. Wireless is only set for wireless interfaces.
+type networkInterface struct {
+	Name          string    `json:"name" yaml:"name"`
+	Type          string    `json:"type" yaml:"type"`
+	BondMaster    string    `json:"bond_master,omitempty" yaml:"bond_master,omitempty"`
+	BondSlaves    []string  `json:"bond_slaves,omitempty" yaml:"bond_slaves,omitempty"`
+	BondMode      string    `json:"bond_mode,omitempty" yaml:"bond_mode,omitempty"`
+	BridgeMaster  string    `json:"bridge_master,omitempty" yaml:"bridge_master,omitempty"`
+	BridgeMembers []string  `json:"bridge_members,omitempty" yaml:"bridge_members,omitempty"`
+	VLANID        uint64    `json:"vlan_id,omitempty" yaml:"vlan_id,omitempty"`
+	VLANParent    string    `json:"vlan_parent,omitempty" yaml:"vlan_parent,omitempty"`
+	Wireless      *wireless `json:"wireless,omitempty" yaml:"wireless,omitempty"`
+}
+
+// vlanInfo is a VLAN interface's tag and the interface it's on.
+type vlanInfo struct {
+	id     uint64
+	parent string
+}
+
+// parseVLANConfig parses /proc/net/vlan/config, whose entries look like
+// "eth0.100 | 100 | eth0" after two header lines.
+func parseVLANConfig(path string) (map[string]vlanInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	vlans := make(map[string]vlanInfo)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "|")
+		if len(fields) != 3 {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(fields[1]), 10, 64)
+		if err != nil {
+			// The "VLAN Dev name | VLAN ID" header.
+			continue
+		}
+		vlans[strings.TrimSpace(fields[0])] = vlanInfo{
+			id:     id,
+			parent: strings.TrimSpace(fields[2]),
+		}
+	}
+	return vlans, scanner.Err()
+}
+
+// parseProcBondingSlaves returns the "Slave Interface" entries of a
+// /proc/net/bonding file, for kernels without bonding/slaves in sysfs.
+func parseProcBondingSlaves(path string) []string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var slaves []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if slave := strings.TrimPrefix(line, "Slave Interface: "); slave != line {
+			slaves = append(slaves, strings.TrimSpace(slave))
+		}
+	}
+	return slaves
+}
+
+// listDir returns the names of the entries in dir, or nil if it can't be
+// read.
+func listDir(dir string) []string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+// exists reports whether path exists.
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// getInterfaces returns every network interface but loopback, with its
+// bond, bridge and VLAN relationships.
+func getInterfaces() ([]networkInterface, error) {
+	dirs, err := filepath.Glob(sysfsPath("class/net/*"))
+	if err != nil {
+		return nil, err
+	}
+	// VLANs aren't always in sysfs, so /proc is the place to look.
+	vlans, _ := parseVLANConfig(procPath("net/vlan/config"))
+	var ifaces []networkInterface
+	for _, dir := range dirs {
+		iface := networkInterface{Name: filepath.Base(dir), Type: ifaceOther}
+		if iface.Name == "lo" {
+			continue
+		}
+		if master, err := os.Readlink(filepath.Join(dir, "master")); err == nil {
+			// A slave is either in a bond or a bridge port.
+			if exists(filepath.Join(dir, "brport")) {
+				iface.BridgeMaster = filepath.Base(master)
+			} else {
+				iface.BondMaster = filepath.Base(master)
+			}
+		}
+		switch vlan, isVLAN := vlans[iface.Name]; {
+		case exists(filepath.Join(dir, "bonding")):
+			iface.Type = ifaceBond
+			slaves, err := readString(filepath.Join(dir, "bonding", "slaves"))
+			if err == nil {
+				iface.BondSlaves = strings.Fields(slaves)
+			} else {
+				iface.BondSlaves = parseProcBondingSlaves(
+					procPath("net/bonding", iface.Name))
+			}
+			// The mode reads as e.g. "802.3ad 4".
+			mode, _ := readString(filepath.Join(dir, "bonding", "mode"))
+			if fields := strings.Fields(mode); len(fields) > 0 {
+				iface.BondMode = fields[0]
+			}
+		case exists(filepath.Join(dir, "bridge")):
+			iface.Type = ifaceBridge
+			iface.BridgeMembers = listDir(filepath.Join(dir, "brif"))
+		case isVLAN:
+			iface.Type = ifaceVLAN
+			iface.VLANID = vlan.id
+			iface.VLANParent = vlan.parent
+		case exists(filepath.Join(dir, "device")):
+			iface.Type = ifacePhysical
+		}
+		if exists(filepath.Join(dir, "wireless")) || exists(filepath.Join(dir, "phy80211")) {
+			iface.Wireless = &wireless{}
+			iface.Wireless.PHY, _ = readString(filepath.Join(dir, "phy80211", "name"))
+		}
+		ifaces = append(ifaces, iface)
+	}
+	sort.Slice(ifaces, func(i, j int) bool {
+		return ifaces[i].Name < ifaces[j].Name
+	})
+	return ifaces, nil
+}
+
+func getNetwork(opts *collectOptions) (*network, error) {
+	lxdNetwork, err := resources.GetNetwork()
+	if err != nil {
+		return nil, err
+	}
+	ifaces, err := getInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	addWirelessDetails(ifaces, opts.run)
+	return &network{ResourcesNetwork: *lxdNetwork, Interfaces: ifaces}, nil
+}
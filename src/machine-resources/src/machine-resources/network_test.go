@@ -0,0 +1,45 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetInterfaces(t *testing.T) {
+	useRoots(t, "testdata/network")
+	ifaces, err := getInterfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []networkInterface{
+		{
+			Name: "bond0", Type: ifaceBond, BondSlaves: []string{"eno1", "eno2"},
+			BondMode: "802.3ad", BridgeMaster: "br0",
+		},
+		{Name: "bond0.100", Type: ifaceVLAN, VLANID: 100, VLANParent: "bond0"},
+		// Older kernels only list the slaves in /proc.
+		{Name: "bond1", Type: ifaceBond, BondSlaves: []string{"eno3"}, BondMode: "active-backup"},
+		{Name: "br0", Type: ifaceBridge, BridgeMembers: []string{"bond0"}},
+		{Name: "eno1", Type: ifacePhysical, BondMaster: "bond0"},
+		{Name: "eno2", Type: ifacePhysical, BondMaster: "bond0"},
+		{Name: "eno3", Type: ifacePhysical, BondMaster: "bond1"},
+		{Name: "wlp2s0", Type: ifacePhysical, Wireless: &wireless{PHY: "phy0"}},
+	}
+	if !reflect.DeepEqual(ifaces, want) {
+		t.Errorf("getInterfaces() =\n%+v\nwant\n%+v", ifaces, want)
+	}
+}
+
+func TestParseVLANConfig(t *testing.T) {
+	vlans, err := parseVLANConfig("testdata/network/proc/net/vlan/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]vlanInfo{"bond0.100": {id: 100, parent: "bond0"}}
+	if !reflect.DeepEqual(vlans, want) {
+		t.Errorf("parseVLANConfig() = %+v, want %+v", vlans, want)
+	}
+}
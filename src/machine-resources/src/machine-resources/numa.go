@@ -0,0 +1,104 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// numaNode is the logical CPUs and memory attached to a NUMA node.
+type numaNode struct {
+	NodeID      uint64   `json:"node_id" yaml:"node_id"`
+	CPUs        []uint64 `json:"cpus" yaml:"cpus"`
+	MemoryBytes uint64   `json:"memory_bytes" yaml:"memory_bytes"`
+}
+
+// readMemTotal returns the MemTotal value, in bytes, from a meminfo file.
+// Both /proc/meminfo and the per-node "Node N MemTotal: ..." form are
+// understood.
+func readMemTotal(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for i, field := range fields {
+			if field != "MemTotal:" || i+1 >= len(fields) {
+				continue
+			}
+			kb, err := strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid MemTotal in %s", path)
+			}
+			return kb * 1024, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no MemTotal in %s", path)
+}
+
+// getNUMA returns the NUMA topology. Machines without NUMA support are
+// reported as a single node covering every CPU and all memory.
+func getNUMA() ([]numaNode, error) {
+	dirs, err := filepath.Glob(sysfsPath("devices/system/node/node[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	if len(dirs) == 0 {
+		list, err := readString(sysfsPath("devices/system/cpu/online"))
+		if err != nil {
+			return nil, err
+		}
+		cpus, err := parseCPUList(list)
+		if err != nil {
+			return nil, err
+		}
+		memory, err := readMemTotal(procPath("meminfo"))
+		if err != nil {
+			return nil, err
+		}
+		return []numaNode{{CPUs: cpus, MemoryBytes: memory}}, nil
+	}
+
+	nodes := make([]numaNode, 0, len(dirs))
+	for _, dir := range dirs {
+		id, err := strconv.ParseUint(
+			strings.TrimPrefix(filepath.Base(dir), "node"), 10, 64)
+		if err != nil {
+			continue
+		}
+		list, err := readString(filepath.Join(dir, "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+		cpus, err := parseCPUList(list)
+		if err != nil {
+			return nil, err
+		}
+		memory, err := readMemTotal(filepath.Join(dir, "meminfo"))
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, numaNode{
+			NodeID:      id,
+			CPUs:        cpus,
+			MemoryBytes: memory,
+		})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].NodeID < nodes[j].NodeID
+	})
+	return nodes, nil
+}
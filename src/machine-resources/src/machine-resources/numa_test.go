@@ -0,0 +1,43 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetNUMA(t *testing.T) {
+	tests := []struct {
+		root string
+		want []numaNode
+	}{
+		{"testdata/numa/two-node", []numaNode{
+			{NodeID: 0, CPUs: []uint64{0, 1, 2, 3, 4, 5, 6, 7, 16, 17, 18, 19, 20, 21, 22, 23}, MemoryBytes: 65842136 * 1024},
+			{NodeID: 1, CPUs: []uint64{8, 9, 10, 11, 12, 13, 14, 15, 24, 25, 26, 27, 28, 29, 30, 31}, MemoryBytes: 66058908 * 1024},
+		}},
+		// Without NUMA, everything is on one node.
+		{"testdata/numa/uma", []numaNode{
+			{NodeID: 0, CPUs: []uint64{0, 1, 2, 3}, MemoryBytes: 8029492 * 1024},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.root, func(t *testing.T) {
+			useRoots(t, test.root)
+			nodes, err := getNUMA()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(nodes, test.want) {
+				t.Errorf("getNUMA() = %+v, want %+v", nodes, test.want)
+			}
+		})
+	}
+}
+
+func TestReadMemTotalMissing(t *testing.T) {
+	if _, err := readMemTotal("testdata/numa/two-node/sys/devices/system/node/online"); err == nil {
+		t.Error("readMemTotal() of a file without MemTotal succeeded")
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lxc/lxd/shared/api"
+)
+
+// storagePartition is a partition as reported by LXD, with what's on it.
+// TypeGUID, Filesystem and UUID come from blkid, and are omitted if it
+// can't probe the partition; Mountpoint is where it's mounted, if anywhere.
+type storagePartition struct {
+	api.ResourcesStorageDiskPartition `yaml:",inline"`
+	TypeGUID                          string `json:"type_guid,omitempty" yaml:"type_guid,omitempty"`
+	Filesystem                        string `json:"filesystem,omitempty" yaml:"filesystem,omitempty"`
+	UUID                              string `json:"uuid,omitempty" yaml:"uuid,omitempty"`
+	Mountpoint                        string `json:"mountpoint,omitempty" yaml:"mountpoint,omitempty"`
+}
+
+// unescapeMountinfo undoes the octal escaping of spaces, tabs, newlines and
+// backslashes in mountinfo fields, as in "/mnt/my\040disk".
+func unescapeMountinfo(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			if c, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
+
+// parseMountinfo returns the first mountpoint of each device in a
+// /proc/<pid>/mountinfo file, keyed by its "major:minor" number.
+func parseMountinfo(r io.Reader) (map[string]string, error) {
+	mounts := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Lines start "36 35 98:0 /mnt1 /mnt2 ...": the mount and parent
+		// IDs, the device, the root of the mount and its mountpoint.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		if _, seen := mounts[fields[2]]; !seen {
+			mounts[fields[2]] = unescapeMountinfo(fields[4])
+		}
+	}
+	return mounts, scanner.Err()
+}
+
+// getMounts returns the mounts of the collecting process, or none if
+// mountinfo can't be read.
+func getMounts() map[string]string {
+	f, err := os.Open(procPath("self/mountinfo"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	mounts, _ := parseMountinfo(f)
+	return mounts
+}
+
+// parseBlkid parses `blkid -p -o export` output, which is KEY=value lines.
+func parseBlkid(data []byte) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		if key, value, found := strings.Cut(line, "="); found {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// addPartitionDetails fills in what's on each partition of disk and where
+// it's mounted, and reports whether the disk or any of its partitions is
+// mounted.
+func addPartitionDetails(disk *storageDisk, mounts map[string]string, run commandRunner) {
+	if dev, err := readString(sysfsPath("class/block", disk.ID, "dev")); err == nil {
+		disk.HasMounts = mounts[dev] != ""
+	}
+	disk.Partitions = make([]storagePartition, len(disk.ResourcesStorageDisk.Partitions))
+	for i, lxdPartition := range disk.ResourcesStorageDisk.Partitions {
+		partition := &disk.Partitions[i]
+		partition.ResourcesStorageDiskPartition = lxdPartition
+		if dev, err := readString(sysfsPath("class/block", lxdPartition.ID, "dev")); err == nil {
+			partition.Mountpoint = mounts[dev]
+		}
+		if partition.Mountpoint != "" {
+			disk.HasMounts = true
+		}
+		// Probing rather than using blkid's cache gets the partition
+		// type, but needs root.
+		data, err := run("blkid", "-p", "-o", "export", "/dev/"+lxdPartition.ID)
+		if err != nil {
+			continue
+		}
+		values := parseBlkid(data)
+		partition.TypeGUID = strings.ToLower(values["PART_ENTRY_TYPE"])
+		partition.Filesystem = values["TYPE"]
+		partition.UUID = values["UUID"]
+	}
+}
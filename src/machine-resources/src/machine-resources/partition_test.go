@@ -0,0 +1,141 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lxc/lxd/shared/api"
+)
+
+func TestUnescapeMountinfo(t *testing.T) {
+	tests := map[string]string{
+		"/boot/efi":                    "/boot/efi",
+		`/mnt/backup\040disk`:          "/mnt/backup disk",
+		`/mnt/a\011b\012c\134d`:        "/mnt/a\tb\nc\\d",
+		`/mnt/trailing\04`:             `/mnt/trailing\04`,
+		`/mnt/not\999octal`:            `/mnt/not\999octal`,
+		`\040leading and trailing\040`: " leading and trailing ",
+	}
+	for field, want := range tests {
+		if got := unescapeMountinfo(field); got != want {
+			t.Errorf("unescapeMountinfo(%q) = %q, want %q", field, got, want)
+		}
+	}
+}
+
+func TestGetMounts(t *testing.T) {
+	useRoots(t, "testdata/partitions")
+	want := map[string]string{
+		"0:21":  "/sys",
+		"0:22":  "/proc",
+		"8:2":   "/",
+		"8:1":   "/boot/efi",
+		"259:0": "/mnt/backup disk",
+	}
+	if got := getMounts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("getMounts() = %v, want %v", got, want)
+	}
+}
+
+func TestGetMountsMissing(t *testing.T) {
+	useRoots(t, "testdata/sysfs")
+	if got := getMounts(); got != nil {
+		t.Errorf("getMounts() = %v without mountinfo, want nil", got)
+	}
+}
+
+func TestParseMountinfoShortLines(t *testing.T) {
+	mounts, err := parseMountinfo(strings.NewReader("36 35 98:0\n\n36 35 98:0 / /mnt rw\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"98:0": "/mnt"}; !reflect.DeepEqual(mounts, want) {
+		t.Errorf("parseMountinfo() = %v, want %v", mounts, want)
+	}
+}
+
+func TestParseBlkid(t *testing.T) {
+	values := parseBlkid(readTestFile(t, "testdata/partitions/blkid/sda1.txt"))
+	// Values can contain spaces, and aren't quoted in export format.
+	if values["PART_ENTRY_NAME"] != "EFI System Partition" || values["TYPE"] != "vfat" {
+		t.Errorf("parseBlkid() = %v", values)
+	}
+	if len(values) != 14 {
+		t.Errorf("parseBlkid() returned %d values, want 14", len(values))
+	}
+}
+
+func TestAddPartitionDetails(t *testing.T) {
+	useRoots(t, "testdata/partitions")
+	mounts := getMounts()
+	run := fakeRunner(map[string]fakeCommand{
+		"blkid -p -o export /dev/sda1": {output: readTestFile(t, "testdata/partitions/blkid/sda1.txt")},
+		"blkid -p -o export /dev/sda2": {output: readTestFile(t, "testdata/partitions/blkid/sda2.txt")},
+		// blkid exits 2 when it finds nothing it recognises.
+		"blkid -p -o export /dev/sdb1": {err: exitError(t, 2, "")},
+	})
+	partition := func(id string, number uint64) api.ResourcesStorageDiskPartition {
+		return api.ResourcesStorageDiskPartition{ID: id, Device: "8:" + strings.TrimPrefix(id, "sd"), Partition: number}
+	}
+	tests := []struct {
+		disk      storageDisk
+		want      []storagePartition
+		hasMounts bool
+	}{
+		{
+			disk: storageDisk{ResourcesStorageDisk: api.ResourcesStorageDisk{
+				ID:         "sda",
+				Partitions: []api.ResourcesStorageDiskPartition{partition("sda1", 1), partition("sda2", 2)},
+			}},
+			want: []storagePartition{
+				{
+					ResourcesStorageDiskPartition: partition("sda1", 1),
+					TypeGUID:                      "c12a7328-f81f-11d2-ba4b-00a0c93ec93b",
+					Filesystem:                    "vfat",
+					UUID:                          "4A1B-9C3D",
+					Mountpoint:                    "/boot/efi",
+				},
+				{
+					// Only the first of the partition's mounts is
+					// reported.
+					ResourcesStorageDiskPartition: partition("sda2", 2),
+					TypeGUID:                      "0fc63daf-8483-4772-8e79-3d69d8477de4",
+					Filesystem:                    "ext4",
+					UUID:                          "6f1c2a3b-7d8e-4f90-a1b2-c3d4e5f60718",
+					Mountpoint:                    "/",
+				},
+			},
+			hasMounts: true,
+		},
+		{
+			disk: storageDisk{ResourcesStorageDisk: api.ResourcesStorageDisk{
+				ID:         "sdb",
+				Partitions: []api.ResourcesStorageDiskPartition{partition("sdb1", 1)},
+			}},
+			want: []storagePartition{{ResourcesStorageDiskPartition: partition("sdb1", 1)}},
+		},
+		{
+			// A filesystem straight on the disk, with no partition
+			// table.
+			disk:      storageDisk{ResourcesStorageDisk: api.ResourcesStorageDisk{ID: "nvme0n1"}},
+			want:      []storagePartition{},
+			hasMounts: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.disk.ID, func(t *testing.T) {
+			disk := test.disk
+			addPartitionDetails(&disk, mounts, run)
+			if !reflect.DeepEqual(disk.Partitions, test.want) {
+				t.Errorf("partitions =\n%+v\nwant\n%+v", disk.Partitions, test.want)
+			}
+			if disk.HasMounts != test.hasMounts {
+				t.Errorf("has_mounts = %v, want %v", disk.HasMounts, test.hasMounts)
+			}
+		})
+	}
+}
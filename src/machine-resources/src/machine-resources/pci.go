@@ -0,0 +1,120 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// modulesPath is where kernel modules, and their modules.alias, live.
+const modulesPath = "/lib/modules"
+
+// pci is the PCI devices in the machine.
+type pci struct {
+	Devices []pciDevice `json:"devices" yaml:"devices"`
+	Total   uint64      `json:"total" yaml:"total"`
+}
+
+// pciDevice is a PCI device and the kernel driver bound to it. Driver is
+// empty for devices that no driver has claimed; Modules lists the modules
+// whose aliases match the device, whether loaded or not.
+type pciDevice struct {
+	PCIAddress string   `json:"pci_address" yaml:"pci_address"`
+	VendorID   string   `json:"vendor_id" yaml:"vendor_id"`
+	ProductID  string   `json:"product_id" yaml:"product_id"`
+	Class      string   `json:"class" yaml:"class"`
+	Driver     string   `json:"driver" yaml:"driver"`
+	Modules    []string `json:"modules,omitempty" yaml:"modules,omitempty"`
+}
+
+// moduleAlias is one "alias <pattern> <module>" line of modules.alias.
+type moduleAlias struct {
+	pattern string
+	module  string
+}
+
+// loadModuleAliases reads the aliases starting with prefix from a
+// modules.alias file.
+func loadModuleAliases(aliasPath, prefix string) ([]moduleAlias, error) {
+	f, err := os.Open(aliasPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var aliases []moduleAlias
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[0] != "alias" {
+			continue
+		}
+		if strings.HasPrefix(fields[1], prefix) {
+			aliases = append(aliases, moduleAlias{fields[1], fields[2]})
+		}
+	}
+	return aliases, scanner.Err()
+}
+
+// matchModules returns the modules with an alias matching modalias.
+func matchModules(aliases []moduleAlias, modalias string) []string {
+	seen := make(map[string]bool)
+	var modules []string
+	for _, alias := range aliases {
+		if seen[alias.module] {
+			continue
+		}
+		if matched, _ := path.Match(alias.pattern, modalias); matched {
+			seen[alias.module] = true
+			modules = append(modules, alias.module)
+		}
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+// hexID strips the 0x prefix sysfs puts on PCI IDs.
+func hexID(value string) string {
+	return strings.TrimPrefix(value, "0x")
+}
+
+// getPCI enumerates PCI devices from sysfs. The modules matching each
+// device are looked up in the running kernel's modules.alias under
+// modulesDir, and left out if it can't be read.
+func getPCI(modulesDir string) (*pci, error) {
+	dirs, err := filepath.Glob(sysfsPath("bus/pci/devices/*"))
+	if err != nil {
+		return nil, err
+	}
+	var aliases []moduleAlias
+	if release, err := readString(procPath("sys/kernel/osrelease")); err == nil {
+		aliases, _ = loadModuleAliases(
+			filepath.Join(modulesDir, release, "modules.alias"), "pci:")
+	}
+	p := &pci{Devices: []pciDevice{}}
+	for _, dir := range dirs {
+		vendor, _ := readString(filepath.Join(dir, "vendor"))
+		product, _ := readString(filepath.Join(dir, "device"))
+		class, _ := readString(filepath.Join(dir, "class"))
+		device := pciDevice{
+			PCIAddress: filepath.Base(dir),
+			VendorID:   hexID(vendor),
+			ProductID:  hexID(product),
+			Class:      hexID(class),
+		}
+		if target, err := os.Readlink(filepath.Join(dir, "driver")); err == nil {
+			device.Driver = filepath.Base(target)
+		}
+		if modalias, err := readString(filepath.Join(dir, "modalias")); err == nil {
+			device.Modules = matchModules(aliases, modalias)
+		}
+		p.Devices = append(p.Devices, device)
+	}
+	p.Total = uint64(len(p.Devices))
+	return p, nil
+}
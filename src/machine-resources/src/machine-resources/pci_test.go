@@ -0,0 +1,51 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetPCI(t *testing.T) {
+	useRoots(t, "testdata/pci")
+	p, err := getPCI("testdata/pci/modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &pci{
+		Devices: []pciDevice{
+			{
+				PCIAddress: "0000:00:1f.6", VendorID: "8086", ProductID: "15bb", Class: "020000",
+				Driver: "e1000e", Modules: []string{"e1000e"},
+			},
+			// No driver is bound to the GPU, but two modules could be.
+			{
+				PCIAddress: "0000:01:00.0", VendorID: "10de", ProductID: "1eb8", Class: "030200",
+				Modules: []string{"nouveau", "nvidiafb"},
+			},
+		},
+		Total: 2,
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("getPCI() = %+v, want %+v", p, want)
+	}
+}
+
+// Modules are optional; without a modules.alias, devices are still listed.
+func TestGetPCIWithoutModules(t *testing.T) {
+	useRoots(t, "testdata/pci")
+	p, err := getPCI("testdata/pci/no-modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Total != 2 {
+		t.Fatalf("found %d devices, want 2", p.Total)
+	}
+	for _, device := range p.Devices {
+		if device.Modules != nil {
+			t.Errorf("device %s has modules %v", device.PCIAddress, device.Modules)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// pluginTimeout is how long a plugin may run before it's killed.
+const pluginTimeout = 30 * time.Second
+
+// pluginOutput is the JSON object a plugin printed, kept exactly as it was
+// for JSON output.
+type pluginOutput struct {
+	json.RawMessage
+}
+
+// MarshalYAML converts the plugin's JSON to YAML.
+func (p pluginOutput) MarshalYAML() (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(p.RawMessage))
+	decoder.UseNumber()
+	return decodeOrderedJSON(decoder)
+}
+
+// runPlugin runs the plugin at path, which must print a JSON object on
+// stdout, killing it after timeout.
+func runPlugin(path string, timeout time.Duration) (pluginOutput, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path)
+	// Children of a killed plugin can hold its stdout open; don't wait on
+	// them.
+	cmd.WaitDelay = time.Second
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return pluginOutput{}, fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			stderr := strings.TrimSpace(string(exitErr.Stderr))
+			if first, _, found := strings.Cut(stderr, "\n"); found {
+				stderr = first
+			}
+			return pluginOutput{}, fmt.Errorf("%v: %s", err, stderr)
+		}
+		return pluginOutput{}, err
+	}
+	out = bytes.TrimSpace(out)
+	if !json.Valid(out) {
+		return pluginOutput{}, fmt.Errorf("printed invalid JSON")
+	}
+	if !bytes.HasPrefix(out, []byte("{")) {
+		return pluginOutput{}, fmt.Errorf("printed JSON that isn't an object")
+	}
+	return pluginOutput{json.RawMessage(out)}, nil
+}
+
+// pluginName is the name a plugin's output is reported under: its file name
+// without any extension.
+func pluginName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// getPlugins runs every executable in dir, returning what each printed and
+// why any failed, both keyed by plugin name. Plugins are run one at a time,
+// in name order. Plugins whose names differ only by extension would be
+// reported under the same name, so none of them are run and the clash is
+// reported as their failure.
+func getPlugins(dir string, timeout time.Duration) (map[string]pluginOutput, map[string]error, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	files := make(map[string][]string)
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() || entry.Mode()&0111 == 0 ||
+			strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		name := pluginName(entry.Name())
+		if files[name] == nil {
+			names = append(names, name)
+		}
+		files[name] = append(files[name], entry.Name())
+	}
+	outputs := make(map[string]pluginOutput)
+	failures := make(map[string]error)
+	for _, name := range names {
+		if len(files[name]) > 1 {
+			failures[name] = fmt.Errorf(
+				"%s would all be reported as %s",
+				strings.Join(files[name], ", "), name)
+			continue
+		}
+		output, err := runPlugin(filepath.Join(dir, files[name][0]), timeout)
+		if err != nil {
+			failures[name] = err
+			continue
+		}
+		outputs[name] = output
+	}
+	if len(outputs) == 0 {
+		outputs = nil
+	}
+	return outputs, failures, nil
+}
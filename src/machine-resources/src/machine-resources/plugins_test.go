@@ -0,0 +1,56 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetPlugins(t *testing.T) {
+	outputs, failures, err := getPlugins("testdata/plugins", 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 1 || string(outputs["location"].RawMessage) != `{"rack": "r12", "slot": 4}` {
+		t.Errorf("got outputs %v, want only location's", outputs)
+	}
+	wantFailures := map[string]string{
+		"asset":     "can't reach the asset database",
+		"garbled":   "invalid JSON",
+		"list":      "isn't an object",
+		"inventory": "inventory.py, inventory.sh would all be reported as inventory",
+	}
+	for name, want := range wantFailures {
+		if err := failures[name]; err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("plugin %s failed with %v, want an error containing %q", name, err, want)
+		}
+	}
+	for name := range failures {
+		if _, expected := wantFailures[name]; !expected {
+			t.Errorf("plugin %s failed unexpectedly: %v", name, failures[name])
+		}
+	}
+}
+
+func TestRunPluginTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slow.sh")
+	writeTestFile(t, path, []byte("#!/bin/sh\nsleep 10\n"))
+	if err := os.Chmod(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	_, err := runPlugin(path, 50*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("runPlugin() = %v, want a timeout", err)
+	}
+}
+
+func TestGetPluginsMissingDir(t *testing.T) {
+	if _, _, err := getPlugins("testdata/no-such-dir", time.Second); err == nil {
+		t.Error("getPlugins() of a missing directory succeeded")
+	}
+}
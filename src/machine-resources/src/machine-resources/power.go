@@ -0,0 +1,79 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"path/filepath"
+)
+
+// powerSupply is a battery, mains adapter or PSU. Fields the kernel doesn't
+// expose for a supply are omitted.
+type powerSupply struct {
+	Name            string  `json:"name" yaml:"name"`
+	Type            string  `json:"type" yaml:"type"`
+	Present         bool    `json:"present" yaml:"present"`
+	Online          *bool   `json:"online,omitempty" yaml:"online,omitempty"`
+	CapacityPercent *uint64 `json:"capacity_percent,omitempty" yaml:"capacity_percent,omitempty"`
+	Status          string  `json:"status,omitempty" yaml:"status,omitempty"`
+	MaxPowerWatts   *uint64 `json:"max_power_watts,omitempty" yaml:"max_power_watts,omitempty"`
+}
+
+// getPowerSupplies reports the power supplies in
+// /sys/class/power_supply, and PSUs that only show up as hwmon devices with
+// a power rating. It returns nil if there are none.
+func getPowerSupplies() ([]powerSupply, error) {
+	dirs, err := filepath.Glob(sysfsPath("class/power_supply/*"))
+	if err != nil {
+		return nil, err
+	}
+	var supplies []powerSupply
+	for _, dir := range dirs {
+		supply := powerSupply{Name: filepath.Base(dir)}
+		supply.Type, _ = readString(filepath.Join(dir, "type"))
+		supply.Status, _ = readString(filepath.Join(dir, "status"))
+		supply.CapacityPercent = readOptionalUint(filepath.Join(dir, "capacity"))
+		if online := readOptionalUint(filepath.Join(dir, "online")); online != nil {
+			value := *online == 1
+			supply.Online = &value
+		}
+		// Batteries say whether they're present; other supplies are
+		// present if they're listed at all.
+		supply.Present = true
+		if present := readOptionalUint(filepath.Join(dir, "present")); present != nil {
+			supply.Present = *present == 1
+		}
+		// power_supply reports microwatts.
+		if max := readOptionalUint(filepath.Join(dir, "power_max")); max != nil {
+			watts := *max / 1000000
+			supply.MaxPowerWatts = &watts
+		}
+		supplies = append(supplies, supply)
+	}
+
+	hwmons, err := filepath.Glob(sysfsPath("class/hwmon/hwmon*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range hwmons {
+		max := readOptionalUint(filepath.Join(dir, "power1_rated_max"))
+		if max == nil {
+			max = readOptionalUint(filepath.Join(dir, "power1_max"))
+		}
+		if max == nil {
+			continue
+		}
+		name, _ := readString(filepath.Join(dir, "name"))
+		if name == "" {
+			name = filepath.Base(dir)
+		}
+		watts := *max / 1000000
+		supplies = append(supplies, powerSupply{
+			Name:          name,
+			Type:          "PSU",
+			Present:       true,
+			MaxPowerWatts: &watts,
+		})
+	}
+	return supplies, nil
+}
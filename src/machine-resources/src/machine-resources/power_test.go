@@ -0,0 +1,44 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func boolPtr(v bool) *bool { return &v }
+
+func TestGetPowerSupplies(t *testing.T) {
+	tests := []struct {
+		root string
+		want []powerSupply
+	}{
+		{"testdata/power/laptop", []powerSupply{
+			{Name: "AC", Type: "Mains", Present: true, Online: boolPtr(true)},
+			{Name: "BAT0", Type: "Battery", Present: true, CapacityPercent: uint64Ptr(87), Status: "Charging"},
+			{Name: "BAT1", Type: "Battery", Present: false},
+		}},
+		{"testdata/power/server", []powerSupply{
+			{Name: "pmbus", Type: "PSU", Present: true, MaxPowerWatts: uint64Ptr(750)},
+			{Name: "hwmon4", Type: "PSU", Present: true, MaxPowerWatts: uint64Ptr(1100)},
+		}},
+		{"testdata/no-such-root", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.root, func(t *testing.T) {
+			useRoots(t, test.root)
+			supplies, err := getPowerSupplies()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Compared as JSON, which is easier to read than pointers.
+			got, _ := json.Marshal(supplies)
+			want, _ := json.Marshal(test.want)
+			if string(got) != string(want) {
+				t.Errorf("getPowerSupplies() = %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Where --profile puts the timings.
+const (
+	profileOff    = ""
+	profileReport = "report"
+	profileStderr = "stderr"
+)
+
+// profileFlag is the --profile setting. Given without a value, as in
+// --profile, it puts the timings in the report.
+type profileFlag string
+
+func (p *profileFlag) String() string {
+	return string(*p)
+}
+
+func (p *profileFlag) Set(value string) error {
+	switch value {
+	case "true", profileReport:
+		*p = profileReport
+	case "false":
+		*p = profileOff
+	case profileStderr:
+		*p = profileStderr
+	default:
+		return fmt.Errorf("expected %s or %s", profileReport, profileStderr)
+	}
+	return nil
+}
+
+// IsBoolFlag lets the flag package accept --profile without a value.
+func (p *profileFlag) IsBoolFlag() bool {
+	return true
+}
+
+// millisecondTimings converts subsystem timings to milliseconds, as they're
+// reported.
+func millisecondTimings(timings map[string]time.Duration) map[string]float64 {
+	ms := make(map[string]float64, len(timings))
+	for name, d := range timings {
+		ms[name] = float64(d) / float64(time.Millisecond)
+	}
+	return ms
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProfileFlag(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    profileFlag
+		wantErr bool
+	}{
+		{args: nil, want: profileOff},
+		{args: []string{"--profile"}, want: profileReport},
+		{args: []string{"--profile=true"}, want: profileReport},
+		{args: []string{"--profile=report"}, want: profileReport},
+		{args: []string{"--profile=stderr"}, want: profileStderr},
+		{args: []string{"--profile=stderr", "--profile=false"}, want: profileOff},
+		{args: []string{"--profile=json"}, wantErr: true},
+	}
+	for _, test := range tests {
+		flags := flag.NewFlagSet("machine-resources", flag.ContinueOnError)
+		flags.SetOutput(ioutil.Discard)
+		var profile profileFlag
+		flags.Var(&profile, "profile", "")
+		err := flags.Parse(test.args)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parsing %v gave %q, want an error", test.args, profile)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsing %v: %v", test.args, err)
+		} else if profile != test.want {
+			t.Errorf("parsing %v gave %q, want %q", test.args, profile, test.want)
+		}
+	}
+}
+
+func TestMillisecondTimings(t *testing.T) {
+	ms := millisecondTimings(map[string]time.Duration{
+		"cpu":     1500 * time.Microsecond,
+		"storage": 2 * time.Second,
+		"dmi":     0,
+	})
+	want := map[string]float64{"cpu": 1.5, "storage": 2000, "dmi": 0}
+	if !reflect.DeepEqual(ms, want) {
+		t.Errorf("millisecondTimings() = %v, want %v", ms, want)
+	}
+}
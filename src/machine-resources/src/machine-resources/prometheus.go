@@ -0,0 +1,119 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// promSample is a single value of a gauge, with its labels as alternating
+// names and values.
+type promSample struct {
+	labels []string
+	value  float64
+}
+
+// promGauge is a gauge and all its samples.
+type promGauge struct {
+	name    string
+	help    string
+	samples []promSample
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (g *promGauge) add(value float64, labels ...string) {
+	g.samples = append(g.samples, promSample{labels: labels, value: value})
+}
+
+func (g *promGauge) write(buf *bytes.Buffer) {
+	if len(g.samples) == 0 {
+		return
+	}
+	fmt.Fprintf(buf, "# HELP %s %s\n", g.name, g.help)
+	fmt.Fprintf(buf, "# TYPE %s gauge\n", g.name)
+	for _, sample := range g.samples {
+		buf.WriteString(g.name)
+		if len(sample.labels) > 0 {
+			pairs := make([]string, 0, len(sample.labels)/2)
+			for i := 0; i+1 < len(sample.labels); i += 2 {
+				pairs = append(pairs, fmt.Sprintf(
+					"%s=\"%s\"", sample.labels[i],
+					promLabelEscaper.Replace(sample.labels[i+1])))
+			}
+			sort.Strings(pairs)
+			fmt.Fprintf(buf, "{%s}", strings.Join(pairs, ","))
+		}
+		fmt.Fprintf(buf, " %s\n", strconv.FormatFloat(sample.value, 'f', -1, 64))
+	}
+}
+
+// marshalPrometheus writes the numeric parts of the report as gauges in the
+// Prometheus text exposition format, as read by node_exporter's textfile
+// collector. String-only fields have no gauge and are left out.
+func marshalPrometheus(v interface{}) ([]byte, error) {
+	var r *machineResources
+	switch v := v.(type) {
+	case *envelope:
+		r = v.Resources
+	case *machineResources:
+		r = v
+	default:
+		return nil, fmt.Errorf("can't write %T as prometheus metrics", v)
+	}
+
+	cores := &promGauge{name: "maas_cpu_cores", help: "Number of CPU cores."}
+	threads := &promGauge{name: "maas_cpu_threads", help: "Number of CPU threads."}
+	memory := &promGauge{name: "maas_memory_total_bytes", help: "Total memory in bytes."}
+	gpus := &promGauge{name: "maas_gpu_cards", help: "Number of GPU cards."}
+	nicSpeed := &promGauge{name: "maas_nic_speed_bytes", help: "Network link speed in bytes per second."}
+	diskSize := &promGauge{name: "maas_disk_size_bytes", help: "Disk size in bytes."}
+	numaMemory := &promGauge{name: "maas_numa_node_memory_bytes", help: "Memory attached to a NUMA node in bytes."}
+
+	if r.CPU != nil {
+		var count int
+		for _, socket := range r.CPU.Sockets {
+			count += len(socket.Cores)
+		}
+		cores.add(float64(count))
+		threads.add(float64(r.CPU.Total))
+	}
+	if r.Memory != nil {
+		memory.add(float64(r.Memory.Total))
+	}
+	if r.GPU != nil {
+		gpus.add(float64(r.GPU.Total))
+	}
+	if r.Network != nil {
+		for _, card := range r.Network.Cards {
+			for _, port := range card.Ports {
+				if port.LinkSpeed == 0 {
+					continue
+				}
+				// LXD reports link speeds in Mbit/s.
+				nicSpeed.add(float64(port.LinkSpeed)*1000000/8, "name", port.ID)
+			}
+		}
+	}
+	if r.Storage != nil {
+		for _, disk := range r.Storage.Disks {
+			diskSize.add(float64(disk.Size), "device", disk.ID, "serial", disk.Serial)
+		}
+	}
+	for _, node := range r.NUMA {
+		numaMemory.add(float64(node.MemoryBytes), "node", fmt.Sprint(node.NodeID))
+	}
+
+	var buf bytes.Buffer
+	for _, g := range []*promGauge{
+		cores, threads, memory, gpus, nicSpeed, diskSize, numaMemory,
+	} {
+		g.write(&buf)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lxc/lxd/shared/api"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+func TestMarshalPrometheus(t *testing.T) {
+	r := &machineResources{
+		CPU: &cpu{
+			ResourcesCPU: api.ResourcesCPU{Total: 8},
+			Sockets:      []cpuSocket{{Cores: make([]cpuCore, 2)}, {Cores: make([]cpuCore, 2)}},
+		},
+		Memory: &memory{ResourcesMemory: api.ResourcesMemory{Total: 17179869184}},
+		Network: &network{ResourcesNetwork: api.ResourcesNetwork{Cards: []api.ResourcesNetworkCard{{
+			Ports: []api.ResourcesNetworkCardPort{
+				{ID: "eno1", LinkSpeed: 10000},
+				{ID: "eno2"},
+			},
+		}}}},
+		Storage: &storage{Disks: []storageDisk{
+			{ResourcesStorageDisk: api.ResourcesStorageDisk{ID: "sda", Serial: `S3Z"9\NB0K`, Size: 500107862016}},
+		}},
+		NUMA: []numaNode{{NodeID: 0, MemoryBytes: 8589934592}, {NodeID: 1, MemoryBytes: 8589934592}},
+	}
+	data, err := marshalPrometheus(&envelope{APIVersion: apiVersion, Resources: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := expfmt.NewTextParser(model.LegacyValidation)
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("invalid exposition format: %v\n%s", err, data)
+	}
+
+	type sample struct {
+		labels map[string]string
+		value  float64
+	}
+	want := map[string][]sample{
+		"maas_cpu_cores":          {{nil, 4}},
+		"maas_cpu_threads":        {{nil, 8}},
+		"maas_memory_total_bytes": {{nil, 17179869184}},
+		"maas_nic_speed_bytes":    {{map[string]string{"name": "eno1"}, 1250000000}},
+		"maas_disk_size_bytes": {
+			{map[string]string{"device": "sda", "serial": `S3Z"9\NB0K`}, 500107862016},
+		},
+		"maas_numa_node_memory_bytes": {
+			{map[string]string{"node": "0"}, 8589934592},
+			{map[string]string{"node": "1"}, 8589934592},
+		},
+	}
+	if len(families) != len(want) {
+		t.Errorf("got %d metrics, want %d:\n%s", len(families), len(want), data)
+	}
+	for name, samples := range want {
+		family, ok := families[name]
+		if !ok {
+			t.Errorf("no %s metric", name)
+			continue
+		}
+		if len(family.Metric) != len(samples) {
+			t.Errorf("%s has %d samples, want %d", name, len(family.Metric), len(samples))
+			continue
+		}
+		for i, metric := range family.Metric {
+			labels := make(map[string]string)
+			for _, label := range metric.Label {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if len(labels) != len(samples[i].labels) {
+				t.Errorf("%s sample %d has labels %v, want %v", name, i, labels, samples[i].labels)
+			}
+			for key, value := range samples[i].labels {
+				if labels[key] != value {
+					t.Errorf("%s sample %d has %s=%q, want %q", name, i, key, labels[key], value)
+				}
+			}
+			if got := metric.GetGauge().GetValue(); got != samples[i].value {
+				t.Errorf("%s sample %d = %v, want %v", name, i, got, samples[i].value)
+			}
+		}
+	}
+}
+
+func TestMarshalPrometheusWrongType(t *testing.T) {
+	if _, err := marshalPrometheus(map[string]string{}); err == nil {
+		t.Error("marshalPrometheus() of a map succeeded")
+	}
+}
@@ -0,0 +1,383 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// raid lists the RAID arrays on the machine. Arrays hide their member disks
+// behind a single block device, so each one names the devices it's built
+// on.
+type raid struct {
+	Software []softwareRAID `json:"software,omitempty" yaml:"software,omitempty"`
+	Hardware []hardwareRAID `json:"hardware,omitempty" yaml:"hardware,omitempty"`
+}
+
+// RAID array states, as reported in raid.*.*.state.
+const (
+	raidActive   = "active"
+	raidInactive = "inactive"
+	raidDegraded = "degraded"
+)
+
+// softwareRAID is an MD array. Devices are the kernel names of its members,
+// which may be partitions, and Disks the storage.disks they're on.
+type softwareRAID struct {
+	Name    string   `json:"name" yaml:"name"`
+	Level   string   `json:"level,omitempty" yaml:"level,omitempty"`
+	State   string   `json:"state" yaml:"state"`
+	Size    uint64   `json:"size,omitempty" yaml:"size,omitempty"`
+	Devices []string `json:"devices,omitempty" yaml:"devices,omitempty"`
+	Spares  []string `json:"spares,omitempty" yaml:"spares,omitempty"`
+	Failed  []string `json:"failed,omitempty" yaml:"failed,omitempty"`
+	Disks   []string `json:"disks,omitempty" yaml:"disks,omitempty"`
+}
+
+// hardwareRAID is a logical volume on a RAID controller. Disk is the block
+// device it appears as, when the tool reports it.
+type hardwareRAID struct {
+	Tool       string `json:"tool" yaml:"tool"`
+	Controller uint64 `json:"controller" yaml:"controller"`
+	Volume     uint64 `json:"volume" yaml:"volume"`
+	Name       string `json:"name,omitempty" yaml:"name,omitempty"`
+	Level      string `json:"level" yaml:"level"`
+	State      string `json:"state" yaml:"state"`
+	Size       uint64 `json:"size,omitempty" yaml:"size,omitempty"`
+	Disk       string `json:"disk,omitempty" yaml:"disk,omitempty"`
+}
+
+// mdstatMember matches an array member in /proc/mdstat, such as "sdb1[1]" or
+// "sdc[2](F)".
+var mdstatMember = regexp.MustCompile(`^([^\[]+)\[[0-9]+\](?:\(([A-Z])\))*$`)
+
+// mdstatStatus matches the member status of an array, such as "[2/1] [U_]".
+var mdstatStatus = regexp.MustCompile(`\[([0-9]+)/([0-9]+)\]`)
+
+// parseMDStat parses the arrays out of /proc/mdstat.
+func parseMDStat(r io.Reader) ([]softwareRAID, error) {
+	var arrays []softwareRAID
+	var current *softwareRAID
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			current = nil
+			continue
+		}
+		if fields[0] == "Personalities" || fields[0] == "unused" {
+			continue
+		}
+		if len(fields) >= 3 && fields[1] == ":" {
+			arrays = append(arrays, softwareRAID{Name: fields[0], State: fields[2]})
+			current = &arrays[len(arrays)-1]
+			for _, field := range fields[3:] {
+				match := mdstatMember.FindStringSubmatch(field)
+				switch {
+				case strings.HasPrefix(field, "("):
+					// Flags such as (auto-read-only).
+				case match == nil:
+					current.Level = field
+				case match[2] == "F":
+					current.Failed = append(current.Failed, match[1])
+				case match[2] == "S":
+					current.Spares = append(current.Spares, match[1])
+				default:
+					current.Devices = append(current.Devices, match[1])
+				}
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if len(fields) >= 2 && fields[1] == "blocks" {
+			// Sizes are in 1 KiB blocks.
+			if blocks, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+				current.Size = blocks * 1024
+			}
+		}
+		if match := mdstatStatus.FindStringSubmatch(line); match != nil {
+			if current.State == raidActive && match[1] != match[2] {
+				current.State = raidDegraded
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return arrays, nil
+}
+
+// parentDisk returns the disk a block device is on, which is the device
+// itself unless it's a partition.
+func parentDisk(device string) string {
+	dir := sysfsPath("class/block", device)
+	if !exists(filepath.Join(dir, "partition")) {
+		return device
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return device
+	}
+	return filepath.Base(filepath.Dir(resolved))
+}
+
+// getSoftwareRAID returns the MD arrays from /proc/mdstat, which is missing
+// if the md driver isn't loaded.
+func getSoftwareRAID() ([]softwareRAID, error) {
+	file, err := os.Open(procPath("mdstat"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	arrays, err := parseMDStat(file)
+	if err != nil {
+		return nil, err
+	}
+	for i := range arrays {
+		// mdstat lists members newest first.
+		sort.Strings(arrays[i].Devices)
+		seen := make(map[string]bool)
+		for _, device := range arrays[i].Devices {
+			disk := parentDisk(device)
+			if !seen[disk] {
+				seen[disk] = true
+				arrays[i].Disks = append(arrays[i].Disks, disk)
+			}
+		}
+	}
+	return arrays, nil
+}
+
+// parseRAIDSize parses a controller tool size such as "446.625 GB". The
+// tools use binary units despite the names.
+func parseRAIDSize(size string) uint64 {
+	fields := strings.Fields(size)
+	if len(fields) != 2 {
+		return 0
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+	multipliers := map[string]float64{
+		"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30, "TB": 1 << 40, "PB": 1 << 50,
+	}
+	multiplier, ok := multipliers[strings.ToUpper(fields[1])]
+	if !ok {
+		return 0
+	}
+	return uint64(value * multiplier)
+}
+
+// storcliStates maps storcli's abbreviated volume states to ours.
+var storcliStates = map[string]string{
+	"Optl": raidActive,
+	"OfLn": raidInactive,
+	"Pdgd": raidDegraded,
+	"Dgrd": raidDegraded,
+}
+
+// storcliVolume is the part of a storcli volume description we use.
+type storcliVolume struct {
+	Type  string `json:"TYPE"`
+	State string `json:"State"`
+	Size  string `json:"Size"`
+	Name  string `json:"Name"`
+}
+
+// storcliOutput is the part of `storcli /call/vall show all J` output we
+// use. Response data is keyed by volume, as in "/c0/v0", with each volume's
+// properties under "VD0 Properties".
+type storcliOutput struct {
+	Controllers []struct {
+		CommandStatus struct {
+			Controller uint64 `json:"Controller"`
+			Status     string `json:"Status"`
+		} `json:"Command Status"`
+		ResponseData map[string]json.RawMessage `json:"Response Data"`
+	} `json:"Controllers"`
+}
+
+// storcliVolumeKey matches the response data keys naming a volume.
+var storcliVolumeKey = regexp.MustCompile(`^/c([0-9]+)/v([0-9]+)$`)
+
+// parseStorcli parses `storcli /call/vall show all J` output.
+func parseStorcli(data []byte) ([]hardwareRAID, error) {
+	var out storcliOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	var volumes []hardwareRAID
+	for _, controller := range out.Controllers {
+		if controller.CommandStatus.Status != "Success" {
+			continue
+		}
+		for key, raw := range controller.ResponseData {
+			match := storcliVolumeKey.FindStringSubmatch(key)
+			if match == nil {
+				continue
+			}
+			var vds []storcliVolume
+			if err := json.Unmarshal(raw, &vds); err != nil || len(vds) == 0 {
+				continue
+			}
+			vd := vds[0]
+			volume := hardwareRAID{
+				Tool:  "storcli",
+				Name:  vd.Name,
+				Level: strings.ToLower(vd.Type),
+				State: storcliStates[vd.State],
+				Size:  parseRAIDSize(vd.Size),
+			}
+			volume.Controller, _ = strconv.ParseUint(match[1], 10, 64)
+			volume.Volume, _ = strconv.ParseUint(match[2], 10, 64)
+			if volume.State == "" {
+				volume.State = strings.ToLower(vd.State)
+			}
+			var properties struct {
+				OSDriveName string `json:"OS Drive Name"`
+			}
+			if raw, ok := controller.ResponseData[fmt.Sprintf("VD%d Properties", volume.Volume)]; ok {
+				if json.Unmarshal(raw, &properties) == nil {
+					volume.Disk = strings.TrimPrefix(properties.OSDriveName, "/dev/")
+				}
+			}
+			volumes = append(volumes, volume)
+		}
+	}
+	sortHardwareRAID(volumes)
+	return volumes, nil
+}
+
+// megacliLevel matches a MegaCli RAID level, such as
+// "Primary-1, Secondary-0, RAID Level Qualifier-0".
+var megacliLevel = regexp.MustCompile(`Primary-([0-9]+), Secondary-([0-9]+)`)
+
+// parseMegacli parses `megacli -LDInfo -Lall -aALL -NoLog` output.
+func parseMegacli(data []byte) []hardwareRAID {
+	var volumes []hardwareRAID
+	var controller uint64
+	var current *hardwareRAID
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "Adapter ") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 {
+				controller, _ = strconv.ParseUint(fields[1], 10, 64)
+			}
+			continue
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		key := strings.TrimSpace(line[:colon])
+		value := strings.TrimSpace(line[colon+1:])
+		if key == "Virtual Drive" {
+			volumes = append(volumes, hardwareRAID{Tool: "megacli", Controller: controller})
+			current = &volumes[len(volumes)-1]
+			fields := strings.Fields(value)
+			if len(fields) > 0 {
+				current.Volume, _ = strconv.ParseUint(fields[0], 10, 64)
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		switch key {
+		case "Name":
+			current.Name = value
+		case "Size":
+			current.Size = parseRAIDSize(value)
+		case "State":
+			switch {
+			case value == "Optimal":
+				current.State = raidActive
+			case value == "Offline":
+				current.State = raidInactive
+			case strings.Contains(value, "Degraded"):
+				current.State = raidDegraded
+			default:
+				current.State = strings.ToLower(value)
+			}
+		case "RAID Level":
+			if match := megacliLevel.FindStringSubmatch(value); match != nil {
+				// Spanned arrays have a secondary level of 3, and are
+				// known as RAID 10, 50 or 60.
+				current.Level = "raid" + match[1]
+				if match[2] != "0" {
+					current.Level += "0"
+				}
+			}
+		}
+	}
+	sortHardwareRAID(volumes)
+	return volumes
+}
+
+// sortHardwareRAID sorts volumes by controller and volume number.
+func sortHardwareRAID(volumes []hardwareRAID) {
+	sort.Slice(volumes, func(i, j int) bool {
+		if volumes[i].Controller != volumes[j].Controller {
+			return volumes[i].Controller < volumes[j].Controller
+		}
+		return volumes[i].Volume < volumes[j].Volume
+	})
+}
+
+// getHardwareRAID returns the logical volumes reported by the first RAID
+// controller tool that's installed, trying storcli before megacli.
+func getHardwareRAID(run commandRunner) []hardwareRAID {
+	for _, tool := range []string{"storcli64", "storcli"} {
+		data, err := run(tool, "/call/vall", "show", "all", "J")
+		if err != nil && len(data) == 0 {
+			continue
+		}
+		if volumes, err := parseStorcli(data); err == nil {
+			return volumes
+		}
+	}
+	for _, tool := range []string{"megacli", "MegaCli64", "MegaCli"} {
+		data, err := run(tool, "-LDInfo", "-Lall", "-aALL", "-NoLog")
+		if err != nil && len(data) == 0 {
+			continue
+		}
+		return parseMegacli(data)
+	}
+	return nil
+}
+
+// getRAID returns the machine's RAID arrays, or nil if there are none.
+// Hardware RAID is only looked for if opts.hardwareRAID is set.
+func getRAID(opts *collectOptions) (*raid, error) {
+	software, err := getSoftwareRAID()
+	if err != nil {
+		return nil, err
+	}
+	r := &raid{Software: software}
+	if opts.hardwareRAID {
+		r.Hardware = getHardwareRAID(opts.run)
+	}
+	if len(r.Software) == 0 && len(r.Hardware) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetSoftwareRAID(t *testing.T) {
+	useRoots(t, "testdata/raid")
+	arrays, err := getSoftwareRAID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []softwareRAID{
+		{
+			Name: "md1", Level: "raid5", State: raidDegraded, Size: 1953260544 * 1024,
+			Devices: []string{"sdd", "sdf"}, Spares: []string{"sde"}, Failed: []string{"sdc"},
+			Disks: []string{"sdd", "sdf"},
+		},
+		// Partitions are traced back to their disks.
+		{
+			Name: "md0", Level: "raid1", State: raidActive, Size: 976630464 * 1024,
+			Devices: []string{"sda1", "sdb1"}, Disks: []string{"sda", "sdb"},
+		},
+		{Name: "md127", State: raidInactive, Size: 976630488 * 1024, Spares: []string{"sdg"}},
+	}
+	if !reflect.DeepEqual(arrays, want) {
+		t.Errorf("getSoftwareRAID() =\n%+v\nwant\n%+v", arrays, want)
+	}
+}
+
+// Without the md driver there's no /proc/mdstat, and no RAID.
+func TestGetRAIDNone(t *testing.T) {
+	useRoots(t, "testdata/no-such-root")
+	r, err := getRAID(&collectOptions{})
+	if err != nil || r != nil {
+		t.Errorf("getRAID() = %+v, %v; want nil, nil", r, err)
+	}
+}
+
+func TestGetHardwareRAID(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands map[string]fakeCommand
+		want     []hardwareRAID
+	}{
+		{
+			name: "storcli",
+			commands: map[string]fakeCommand{
+				// storcli exits non-zero when any controller failed.
+				"storcli /call/vall show all J": {readTestFile(t, "testdata/raid/storcli.json"), exitError(t, 1, "")},
+			},
+			want: []hardwareRAID{
+				{Tool: "storcli", Volume: 0, Name: "os", Level: "raid1", State: raidActive, Size: 479559942144, Disk: "sdb"},
+				{Tool: "storcli", Volume: 1, Name: "data", Level: "raid10", State: raidDegraded, Size: 3998923790221, Disk: "sdc"},
+			},
+		},
+		{
+			name: "megacli",
+			commands: map[string]fakeCommand{
+				"MegaCli64 -LDInfo -Lall -aALL -NoLog": {readTestFile(t, "testdata/raid/megacli.txt"), nil},
+			},
+			want: []hardwareRAID{
+				{Tool: "megacli", Volume: 0, Name: "os", Level: "raid1", State: raidActive, Size: 299439751168},
+				{Tool: "megacli", Volume: 1, Level: "raid10", State: raidDegraded, Size: 1197368162648},
+			},
+		},
+		{name: "no tools"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := getHardwareRAID(fakeRunner(test.commands))
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("getHardwareRAID() =\n%+v\nwant\n%+v", got, test.want)
+			}
+		})
+	}
+}
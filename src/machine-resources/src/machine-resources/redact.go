@@ -0,0 +1,97 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// redactor replaces identifying values with a salted hash. The same value
+// always hashes the same way for a given salt, so duplicates can still be
+// spotted in a redacted report.
+type redactor struct {
+	salt []byte
+}
+
+// newRedactor returns a redactor using salt, or a random salt if it's empty.
+func newRedactor(salt string) (*redactor, error) {
+	if salt != "" {
+		return &redactor{salt: []byte(salt)}, nil
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	return &redactor{salt: random}, nil
+}
+
+func (rd *redactor) hash(value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, rd.salt)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// hashIfEmbeds hashes value if it contains any of ids, and otherwise leaves
+// it alone.
+func (rd *redactor) hashIfEmbeds(value string, ids ...string) string {
+	for _, id := range ids {
+		if id != "" && strings.Contains(value, id) {
+			return rd.hash(value)
+		}
+	}
+	return value
+}
+
+// redact replaces disk serial numbers, WWNs and the names derived from them,
+// filesystem UUIDs, NIC MAC addresses, InfiniBand node GUIDs, the BMC's MAC
+// address, board and chassis serial numbers, and the machine identifiers in
+// r.
+func (rd *redactor) redact(r *machineResources) {
+	if r.Storage != nil {
+		for i := range r.Storage.Disks {
+			disk := &r.Storage.Disks[i]
+			// The /dev/disk/by-id name is made from the model and serial
+			// or the WWN, and SAS disks' by-path names embed their WWN,
+			// with or without its 0x.
+			disk.DeviceID = rd.hash(disk.DeviceID)
+			disk.DevicePath = rd.hashIfEmbeds(
+				disk.DevicePath, disk.Serial, disk.WWN, strings.TrimPrefix(disk.WWN, "0x"))
+			disk.Serial = rd.hash(disk.Serial)
+			disk.WWN = rd.hash(disk.WWN)
+			for j := range disk.Partitions {
+				disk.Partitions[j].UUID = rd.hash(disk.Partitions[j].UUID)
+			}
+		}
+	}
+	if r.Network != nil {
+		for i := range r.Network.Cards {
+			card := &r.Network.Cards[i]
+			for j := range card.Ports {
+				card.Ports[j].Address = rd.hash(card.Ports[j].Address)
+			}
+		}
+	}
+	for i := range r.Infiniband {
+		r.Infiniband[i].NodeGUID = rd.hash(r.Infiniband[i].NodeGUID)
+	}
+	if r.BMC != nil && r.BMC.LAN != nil {
+		r.BMC.LAN.MACAddress = rd.hash(r.BMC.LAN.MACAddress)
+	}
+	if r.DMI != nil {
+		r.DMI.BoardSerial = rd.hash(r.DMI.BoardSerial)
+		r.DMI.ChassisSerial = rd.hash(r.DMI.ChassisSerial)
+	}
+	if r.Identifiers != nil {
+		r.Identifiers.MachineID = rd.hash(r.Identifiers.MachineID)
+		r.Identifiers.ProductUUID = rd.hash(r.Identifiers.ProductUUID)
+		r.Identifiers.ChassisAssetTag = rd.hash(r.Identifiers.ChassisAssetTag)
+	}
+}
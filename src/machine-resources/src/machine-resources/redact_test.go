@@ -0,0 +1,143 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lxc/lxd/shared/api"
+)
+
+// redactionTestResources returns resources carrying every identifier
+// --redact should hide, along with the identifiers themselves.
+func redactionTestResources() (*machineResources, []string) {
+	identifying := []string{
+		"S3Z9NB0K123456A",
+		"ata-Samsung_SSD_860_EVO_500GB_S3Z9NB0K123456A",
+		"0x5002538e40a1b2c3",
+		"nvme-eui.0025388b71b2c3d4",
+		"eui.0025388b71b2c3d4",
+		"PHLJ9123004K1P0FGN",
+		"0x5000c500a1b2c3d4",
+		"wwn-0x5000c500a1b2c3d4",
+		"pci-0000:02:00.0-sas-0x5000c500a1b2c3d4-lun-0",
+		"ZC1A2B3C",
+		"3f1ad5c6-1a3e-4f0b-9c59-0e6a1b2c3d4e",
+		"00:16:3e:12:34:56",
+		"00:16:3e:ab:cd:ef",
+		"0c:c4:7a:11:22:33",
+		"0c:c4:7a:aa:bb:cc",
+		"98039b0300a1b2c3",
+		"QTFCA1234567",
+		"CZJ1234567",
+		"4f0c5b5e2d6a4e0f9f6b2c8d7e1a3b5c",
+		"03000200-0400-0500-0006-000700080009",
+		"ASSET-0042",
+	}
+	r := &machineResources{
+		Storage: &storage{Disks: []storageDisk{
+			{
+				ResourcesStorageDisk: api.ResourcesStorageDisk{
+					ID:         "sda",
+					Serial:     "S3Z9NB0K123456A",
+					WWN:        "0x5002538e40a1b2c3",
+					DeviceID:   "ata-Samsung_SSD_860_EVO_500GB_S3Z9NB0K123456A",
+					DevicePath: "pci-0000:00:17.0-ata-1",
+				},
+				Partitions: []storagePartition{{
+					ResourcesStorageDiskPartition: api.ResourcesStorageDiskPartition{ID: "sda1"},
+					UUID:                          "3f1ad5c6-1a3e-4f0b-9c59-0e6a1b2c3d4e",
+				}},
+			},
+			{
+				ResourcesStorageDisk: api.ResourcesStorageDisk{
+					ID:         "nvme0n1",
+					Serial:     "PHLJ9123004K1P0FGN",
+					WWN:        "eui.0025388b71b2c3d4",
+					DeviceID:   "nvme-eui.0025388b71b2c3d4",
+					DevicePath: "pci-0000:01:00.0-nvme-1",
+				},
+			},
+			{
+				ResourcesStorageDisk: api.ResourcesStorageDisk{
+					ID:         "sdb",
+					Serial:     "ZC1A2B3C",
+					WWN:        "0x5000c500a1b2c3d4",
+					DeviceID:   "wwn-0x5000c500a1b2c3d4",
+					DevicePath: "pci-0000:02:00.0-sas-0x5000c500a1b2c3d4-lun-0",
+				},
+			},
+		}},
+		Network: &network{ResourcesNetwork: api.ResourcesNetwork{Cards: []api.ResourcesNetworkCard{
+			{Ports: []api.ResourcesNetworkCardPort{
+				{ID: "eno1", Address: "00:16:3e:12:34:56"},
+				{ID: "eno2", Address: "00:16:3e:ab:cd:ef"},
+			}},
+			{Ports: []api.ResourcesNetworkCardPort{
+				{ID: "enp3s0f0", Address: "0c:c4:7a:11:22:33"},
+			}},
+		}}},
+		Infiniband: []infinibandDevice{{Name: "mlx5_0", NodeGUID: "98039b0300a1b2c3"}},
+		DMI:        &dmiInfo{BoardSerial: "QTFCA1234567", ChassisSerial: "CZJ1234567"},
+		Identifiers: &identifiers{
+			MachineID:       "4f0c5b5e2d6a4e0f9f6b2c8d7e1a3b5c",
+			ProductUUID:     "03000200-0400-0500-0006-000700080009",
+			ChassisAssetTag: "ASSET-0042",
+		},
+		BMC: &bmc{LAN: &bmcLAN{MACAddress: "0c:c4:7a:aa:bb:cc"}},
+	}
+	return r, identifying
+}
+
+func TestRedactHidesIdentifiers(t *testing.T) {
+	r, identifying := redactionTestResources()
+	rd, err := newRedactor("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd.redact(r)
+	for format, marshal := range marshalers {
+		data, err := marshal(&envelope{APIVersion: apiVersion, Resources: r})
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		for _, id := range identifying {
+			if strings.Contains(string(data), id) {
+				t.Errorf("%s output contains %q after redacting", format, id)
+			}
+		}
+	}
+}
+
+func TestRedactKeepsDevicePathWithoutIdentifiers(t *testing.T) {
+	r, _ := redactionTestResources()
+	rd, err := newRedactor("salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd.redact(r)
+	if got := r.Storage.Disks[0].DevicePath; got != "pci-0000:00:17.0-ata-1" {
+		t.Errorf("DevicePath = %q, want it unchanged", got)
+	}
+}
+
+func TestRedactIsStableForSalt(t *testing.T) {
+	first, _ := redactionTestResources()
+	second, _ := redactionTestResources()
+	for _, r := range []*machineResources{first, second} {
+		rd, err := newRedactor("salt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rd.redact(r)
+	}
+	if first.Storage.Disks[0].Serial != second.Storage.Disks[0].Serial {
+		t.Errorf("serial hashed to %q and %q with the same salt",
+			first.Storage.Disks[0].Serial, second.Storage.Disks[0].Serial)
+	}
+	if first.Storage.Disks[0].Serial == first.Storage.Disks[1].Serial {
+		t.Error("different serials hashed the same")
+	}
+}
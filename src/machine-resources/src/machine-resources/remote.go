@@ -0,0 +1,204 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// remoteFlags apply to the local side of --remote and so aren't passed on
+// to the remote machine.
+var remoteFlags = map[string]bool{
+	"remote":   true,
+	"identity": true,
+	"output":   true,
+	"o":        true,
+}
+
+// localPathFlags name paths on the local machine, which needn't exist on
+// the remote one, so --remote refuses them rather than passing them on.
+var localPathFlags = map[string]bool{
+	"sign":       true,
+	"diff":       true,
+	"plugin-dir": true,
+	"cache-path": true,
+	"sysfs-root": true,
+	"proc-root":  true,
+}
+
+// checkRemoteFlags returns an error naming any of localPathFlags that were
+// set on the command line.
+func checkRemoteFlags(flags *flag.FlagSet) error {
+	var local []string
+	flags.Visit(func(f *flag.Flag) {
+		if localPathFlags[f.Name] {
+			local = append(local, "--"+f.Name)
+		}
+	})
+	if len(local) > 0 {
+		return fmt.Errorf(
+			"--remote can't be used with %s, which name local paths",
+			strings.Join(local, ", "))
+	}
+	return nil
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// remoteArgs returns the flags that were set on the command line, other
+// than remoteFlags, for running the same collection remotely.
+func remoteArgs(flags *flag.FlagSet) []string {
+	var args []string
+	flags.Visit(func(f *flag.Flag) {
+		if !remoteFlags[f.Name] {
+			args = append(args, shellQuote(fmt.Sprintf("--%s=%s", f.Name, f.Value)))
+		}
+	})
+	return args
+}
+
+// sshAuth returns the authentication method to use: the private key in
+// identity if given, otherwise the keys held by the SSH agent.
+func sshAuth(identity string) (ssh.AuthMethod, error) {
+	if identity != "" {
+		key, err := ioutil.ReadFile(identity)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity %s: %v", identity, err)
+		}
+		return ssh.PublicKeys(signer), nil
+	}
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, fmt.Errorf("no --identity given and no SSH agent running")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("can't reach SSH agent: %v", err)
+	}
+	return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), nil
+}
+
+// sshConfig returns the client configuration for target, which is of the
+// form [user@]host[:port]. Host keys are checked against the user's
+// known_hosts.
+func sshConfig(target, identity string) (string, *ssh.ClientConfig, error) {
+	username, address := "", target
+	if i := strings.LastIndex(target, "@"); i >= 0 {
+		username, address = target[:i], target[i+1:]
+	}
+	if username == "" {
+		current, err := user.Current()
+		if err != nil {
+			return "", nil, err
+		}
+		username = current.Username
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "22")
+	}
+	auth, err := sshAuth(identity)
+	if err != nil {
+		return "", nil, err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", nil, err
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return "", nil, err
+	}
+	return address, &ssh.ClientConfig{
+		User:            username,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeys,
+		Timeout:         30 * time.Second,
+	}, nil
+}
+
+// runSession runs cmd in a new session on client, feeding it stdin.
+func runSession(client *ssh.Client, cmd string, stdin io.Reader, stdout, stderr io.Writer) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+	return session.Run(cmd)
+}
+
+// runRemote copies this binary to target and runs it there with args,
+// relaying its output. The binary must suit the remote machine's
+// architecture. The returned exit code is the remote binary's.
+func runRemote(target, identity string, args []string, stdout, stderr io.Writer) (int, error) {
+	address, config, err := sshConfig(target, identity)
+	if err != nil {
+		return 0, err
+	}
+	client, err := ssh.Dial("tcp", address, config)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	self, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	binary, err := os.Open(self)
+	if err != nil {
+		return 0, err
+	}
+	defer binary.Close()
+	return runCopy(client, binary, args, stdout, stderr)
+}
+
+// runCopy copies binary to a temporary file on the machine client is
+// connected to, runs it with args and removes it again, returning its exit
+// code.
+func runCopy(client *ssh.Client, binary io.Reader, args []string, stdout, stderr io.Writer) (int, error) {
+	var path bytes.Buffer
+	err := runSession(
+		client, `f=$(mktemp) && cat > "$f" && chmod 700 "$f" && echo "$f"`,
+		binary, &path, stderr)
+	if err != nil {
+		return 0, fmt.Errorf("copying binary to %s: %v", client.RemoteAddr(), err)
+	}
+
+	remotePath := shellQuote(strings.TrimSpace(path.String()))
+	cmd := fmt.Sprintf(
+		"%s %s; rc=$?; rm -f %s; exit $rc",
+		remotePath, strings.Join(args, " "), remotePath)
+	err = runSession(client, cmd, nil, stdout, stderr)
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		return exitErr.ExitStatus(), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
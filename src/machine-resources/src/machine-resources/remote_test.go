@@ -0,0 +1,202 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"flag"
+	"net"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// startSSHServer starts an SSH server on localhost that lets anyone in and
+// runs each command it's sent with sh, returning its address and host key.
+func startSSHServer(t *testing.T) (string, ssh.PublicKey) {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(hostKey)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config)
+		}
+	}()
+	return listener.Addr().String(), hostKey.PublicKey()
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "sessions only")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go serveSession(channel, requests)
+	}
+}
+
+// serveSession runs the session's exec request and reports its exit status.
+func serveSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for request := range requests {
+		if request.Type != "exec" {
+			request.Reply(false, nil)
+			continue
+		}
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(request.Payload, &payload); err != nil {
+			request.Reply(false, nil)
+			return
+		}
+		request.Reply(true, nil)
+		cmd := exec.Command("sh", "-c", payload.Command)
+		cmd.Stdin = channel
+		cmd.Stdout = channel
+		cmd.Stderr = channel.Stderr()
+		var status uint32
+		if err := cmd.Run(); err != nil {
+			status = 255
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				status = uint32(exitErr.ExitCode())
+			}
+		}
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+// fakeBinary stands in for machine-resources on the remote machine. It
+// reports its arguments and path on stderr.
+const fakeBinary = `#!/bin/sh
+printf '%s\n' "$@" >&2
+echo "path=$0" >&2
+echo '{"api_version": 1}'
+exit 3
+`
+
+func TestRunCopy(t *testing.T) {
+	address, hostKey := startSSHServer(t)
+	client, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            "maas",
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	args := []string{shellQuote("--select=memory.total"), shellQuote("--redact-salt=it's $HOME")}
+	var stdout, stderr bytes.Buffer
+	code, err := runCopy(client, strings.NewReader(fakeBinary), args, &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("runCopy() = %v (stderr %q)", err, stderr.String())
+	}
+	if code != 3 {
+		t.Errorf("exit code = %d, want the remote binary's 3", code)
+	}
+	if got, want := stdout.String(), "{\"api_version\": 1}\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("stderr = %q, want the two arguments and the path", stderr.String())
+	}
+	if want := []string{"--select=memory.total", "--redact-salt=it's $HOME"}; !reflect.DeepEqual(lines[:2], want) {
+		t.Errorf("remote arguments = %q, want %q", lines[:2], want)
+	}
+	path := strings.TrimPrefix(lines[2], "path=")
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("copied binary %s wasn't removed: %v", path, err)
+	}
+}
+
+// testFlags returns a flag set with the flags the remote tests use, parsed
+// from args.
+func testFlags(t *testing.T, args ...string) *flag.FlagSet {
+	t.Helper()
+	flags := flag.NewFlagSet("machine-resources", flag.ContinueOnError)
+	for _, name := range []string{"remote", "identity", "output", "format", "sign", "diff", "plugin-dir", "cache-path", "sysfs-root", "proc-root"} {
+		flags.String(name, "", "")
+	}
+	flags.Bool("redact", false, "")
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return flags
+}
+
+func TestRemoteArgs(t *testing.T) {
+	flags := testFlags(t, "--remote=maas@node1", "--identity=/tmp/id", "--output=out.json", "--format=yaml", "--redact")
+	got := remoteArgs(flags)
+	want := []string{"'--format=yaml'", "'--redact=true'"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("remoteArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestCheckRemoteFlags(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{[]string{"--remote=node1", "--format=yaml", "--output=out.json"}, ""},
+		{[]string{"--remote=node1", "--sign=key.pem"}, "--sign"},
+		{[]string{"--remote=node1", "--diff=old.json", "--plugin-dir=plugins"}, "--diff, --plugin-dir"},
+		{[]string{"--remote=node1", "--cache-path=cache.json"}, "--cache-path"},
+		{[]string{"--remote=node1", "--sysfs-root=sys", "--proc-root=proc"}, "--proc-root, --sysfs-root"},
+	}
+	for _, test := range tests {
+		err := checkRemoteFlags(testFlags(t, test.args...))
+		if test.wantErr == "" {
+			if err != nil {
+				t.Errorf("checkRemoteFlags(%q) = %v, want nil", test.args, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("checkRemoteFlags(%q) = %v, want an error naming %s", test.args, err, test.wantErr)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, s := range []string{"plain", "it's", "$(rm -rf /)", `back\slash "quoted"`} {
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(s)).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != s {
+			t.Errorf("sh saw %q for shellQuote(%q), want it unchanged", out, s)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os/exec"
+	"sort"
+)
+
+// permissionMessage is how tools report the EACCES they got from the
+// kernel.
+var permissionMessage = []byte("Permission denied")
+
+// deniedPermission reports whether err, from reading a file or running a
+// tool, was for lack of permission. Tools exit with a status of their own
+// rather than EACCES, so what they printed, which is out and their stderr,
+// is checked for the kernel's message instead.
+func deniedPermission(out []byte, err error) bool {
+	if errors.Is(err, fs.ErrPermission) {
+		return true
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	return bytes.Contains(exitErr.Stderr, permissionMessage) ||
+		bytes.Contains(out, permissionMessage)
+}
+
+// requireRoot adds entry, a subsystem or the dotted path of a field, to the
+// sorted list of what couldn't be collected for lack of permission.
+func (r *machineResources) requireRoot(entry string) {
+	i := sort.SearchStrings(r.RequiresRoot, entry)
+	if i < len(r.RequiresRoot) && r.RequiresRoot[i] == entry {
+		return
+	}
+	r.RequiresRoot = append(r.RequiresRoot, "")
+	copy(r.RequiresRoot[i+1:], r.RequiresRoot[i:])
+	r.RequiresRoot[i] = entry
+}
+
+// permissionDenied returns the function that collectors reading files for
+// subsystem call with each field they were denied permission to read.
+func (r *machineResources) permissionDenied(subsystem string) func(field string) {
+	return func(field string) {
+		r.requireRoot(subsystem + "." + field)
+	}
+}
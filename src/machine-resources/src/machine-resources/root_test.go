@@ -0,0 +1,102 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"log/slog"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestDeniedPermission(t *testing.T) {
+	pathErr := &fs.PathError{Op: "open", Path: "/sys/firmware/dmi/tables/DMI", Err: fs.ErrPermission}
+	tests := []struct {
+		name string
+		out  []byte
+		err  error
+		want bool
+	}{
+		{name: "EACCES", err: pathErr, want: true},
+		{name: "wrapped", err: fmt.Errorf("reading DMI: %w", pathErr), want: true},
+		{name: "missing", err: &fs.PathError{Op: "open", Path: "/dev/ipmi0", Err: fs.ErrNotExist}},
+		{
+			name: "stderr",
+			err:  exitError(t, 2, "Smartctl open device: /dev/sda failed: Permission denied\n"),
+			want: true,
+		},
+		{
+			// smartctl prints its errors on stdout.
+			name: "output",
+			out:  []byte("Smartctl open device: /dev/sda failed: Permission denied\n"),
+			err:  exitError(t, 2, ""),
+			want: true,
+		},
+		{name: "other failure", out: []byte("No such device\n"), err: exitError(t, 1, "Read failed\n")},
+		{name: "not installed", err: &exec.Error{Name: "smartctl", Err: exec.ErrNotFound}},
+		// Without an exit status, the output isn't from a tool that
+		// failed.
+		{name: "no exit status", out: []byte("Permission denied"), err: errors.New("timed out")},
+		{name: "no error"},
+	}
+	for _, test := range tests {
+		if got := deniedPermission(test.out, test.err); got != test.want {
+			t.Errorf("%s: deniedPermission() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRequireRoot(t *testing.T) {
+	r := &machineResources{}
+	for _, entry := range []string{"storage", "dmi.board_serial", "cpu", "storage", "dmi.board_serial"} {
+		r.requireRoot(entry)
+	}
+	r.permissionDenied("dmi")("product_serial")
+	want := []string{"cpu", "dmi.board_serial", "dmi.product_serial", "storage"}
+	if !reflect.DeepEqual(r.RequiresRoot, want) {
+		t.Errorf("requires_root = %v, want %v", r.RequiresRoot, want)
+	}
+}
+
+func TestCollectSubsystemsRequiresRoot(t *testing.T) {
+	denied := exitError(t, 2, "Smartctl open device: /dev/sda failed: Permission denied\n")
+	fake := fakeRunner(map[string]fakeCommand{
+		"smartctl --json --all /dev/sda": {err: denied},
+		"nvidia-smi":                     {err: exitError(t, 9, "NVIDIA-SMI has failed\n")},
+	})
+	selected := []subsystem{
+		// A collector carrying on without a tool it was denied still
+		// needs root for a full report.
+		{"storage", false, func(r *machineResources, opts *collectOptions) error {
+			opts.run("smartctl", "--json", "--all", "/dev/sda")
+			return nil
+		}},
+		{"gpu", false, func(r *machineResources, opts *collectOptions) error {
+			_, err := opts.run("nvidia-smi")
+			return err
+		}},
+		{"dmi", false, func(r *machineResources, opts *collectOptions) error {
+			return &fs.PathError{Op: "open", Path: "/sys/firmware/dmi/tables/DMI", Err: fs.ErrPermission}
+		}},
+	}
+	opts := &collectOptions{
+		run:    fake,
+		logger: slog.New(slog.NewTextHandler(ioutil.Discard, nil)),
+	}
+	r, ok := collectSubsystems(context.Background(), selected, opts)
+	if !ok {
+		t.Error("collectSubsystems() failed, though no core subsystem did")
+	}
+	if want := []string{"dmi", "storage"}; !reflect.DeepEqual(r.RequiresRoot, want) {
+		t.Errorf("requires_root = %v, want %v", r.RequiresRoot, want)
+	}
+	if _, failed := r.Errors["storage"]; failed || len(r.Errors) != 2 {
+		t.Errorf("errors = %v, want gpu and dmi", r.Errors)
+	}
+}
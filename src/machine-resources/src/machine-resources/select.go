@@ -0,0 +1,80 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// selectPath returns the value at a dotted path into the resources, such as
+// "memory.total" or "storage.disks.0.size", where numeric components index
+// arrays.
+func selectPath(r *machineResources, path string) (interface{}, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	v, err := decodeExact(data)
+	if err != nil {
+		return nil, err
+	}
+	components := strings.Split(path, ".")
+	for i, component := range components {
+		at := strings.Join(components[:i+1], ".")
+		if component == "" {
+			return nil, fmt.Errorf("invalid path %q", path)
+		}
+		switch value := v.(type) {
+		case map[string]interface{}:
+			child, ok := value[component]
+			if !ok {
+				return nil, fmt.Errorf("no value at %q", at)
+			}
+			v = child
+		case []interface{}:
+			index, err := strconv.Atoi(component)
+			if err != nil {
+				return nil, fmt.Errorf("%q is an array, not an object", strings.Join(components[:i], "."))
+			}
+			if index < 0 || index >= len(value) {
+				return nil, fmt.Errorf("no value at %q (%d elements)", at, len(value))
+			}
+			v = value[index]
+		default:
+			return nil, fmt.Errorf("no value at %q", at)
+		}
+	}
+	return v, nil
+}
+
+// decodeExact decodes JSON generically like json.Unmarshal, but keeps
+// numbers as json.Number so that large sizes survive exactly.
+func decodeExact(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// formatSelected formats a selected value for output: scalars as their bare
+// text, so that scripts can use them directly, and anything else with
+// marshal.
+func formatSelected(v interface{}, marshal func(interface{}) ([]byte, error)) ([]byte, error) {
+	switch value := v.(type) {
+	case string:
+		return []byte(value), nil
+	case json.Number:
+		return []byte(value.String()), nil
+	case bool:
+		return []byte(strconv.FormatBool(value)), nil
+	}
+	return marshal(v)
+}
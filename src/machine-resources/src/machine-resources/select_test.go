@@ -0,0 +1,63 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSelectPath(t *testing.T) {
+	r := &machineResources{
+		NUMA: []numaNode{
+			{NodeID: 0, CPUs: []uint64{0, 1}, MemoryBytes: 18446744073709551615},
+			{NodeID: 1, CPUs: []uint64{2, 3}, MemoryBytes: 8589934592},
+		},
+		Virt: &virtualization{Type: virtVM, Hypervisor: "kvm"},
+	}
+	tests := []struct {
+		path    string
+		want    string
+		wantErr string
+	}{
+		{path: "virtualization.hypervisor", want: "kvm"},
+		// Sizes are kept exactly, not rounded through float64.
+		{path: "numa.0.memory_bytes", want: "18446744073709551615"},
+		{path: "numa.1.cpus", want: "[2,3]"},
+		{path: "virtualization", want: `{"hypervisor":"kvm","type":"vm"}`},
+		{path: "numa.2", wantErr: `no value at "numa.2" (2 elements)`},
+		{path: "numa.first", wantErr: `"numa" is an array, not an object`},
+		{path: "gpu", wantErr: `no value at "gpu"`},
+		{path: "virtualization.type.name", wantErr: `no value at "virtualization.type.name"`},
+		{path: "numa..cpus", wantErr: `invalid path "numa..cpus"`},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			v, err := selectPath(r, test.path)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Errorf("selectPath() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := formatSelected(v, json.Marshal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.want {
+				t.Errorf("selected %s, want %s", data, test.want)
+			}
+		})
+	}
+}
+
+func TestFormatSelectedBool(t *testing.T) {
+	data, err := formatSelected(true, json.Marshal)
+	if err != nil || string(data) != "true" {
+		t.Errorf("formatSelected(true) = %q, %v; want true", data, err)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// sanityCheck is a --self-test plausibility check of one subsystem's
+// resources. A failed hard check means the report can't be trusted; other
+// checks only warn.
+type sanityCheck struct {
+	subsystem string
+	hard      bool
+	// check returns whether the resources pass, and a description of what
+	// was found.
+	check func(r *machineResources) (bool, string)
+}
+
+var sanityChecks = []sanityCheck{
+	{"cpu", true, func(r *machineResources) (bool, string) {
+		var cores int
+		if r.CPU != nil {
+			for _, socket := range r.CPU.Sockets {
+				cores += len(socket.Cores)
+			}
+		}
+		return cores > 0, fmt.Sprintf("%d cores", cores)
+	}},
+	{"memory", true, func(r *machineResources) (bool, string) {
+		var total uint64
+		if r.Memory != nil {
+			total = r.Memory.Total
+		}
+		return total > 0, fmt.Sprintf("%d bytes total", total)
+	}},
+	// Diskless machines, booting over the network, are legitimate.
+	{"storage", false, func(r *machineResources) (bool, string) {
+		if r.Storage == nil {
+			return false, "no storage information"
+		}
+		if len(r.Storage.Disks) == 0 {
+			return true, "no disks (diskless)"
+		}
+		return true, fmt.Sprintf("%d disks", len(r.Storage.Disks))
+	}},
+	{"network", true, func(r *machineResources) (bool, string) {
+		var ifaces int
+		if r.Network != nil {
+			ifaces = len(r.Network.Interfaces)
+		}
+		return ifaces > 0, fmt.Sprintf("%d interfaces", ifaces)
+	}},
+}
+
+// selfTest runs the sanity checks for the selected subsystems against r,
+// writing a PASS or FAIL line for each to w, and reports whether all the
+// hard checks passed. Checks of subsystems that failed to collect fail with
+// the collection error.
+func selfTest(w io.Writer, checks []sanityCheck, r *machineResources, selected []subsystem) bool {
+	collected := make(map[string]bool, len(selected))
+	for _, s := range selected {
+		collected[s.name] = true
+	}
+	passed := true
+	for _, c := range checks {
+		if !collected[c.subsystem] {
+			fmt.Fprintf(w, "SKIP %s: not collected\n", c.subsystem)
+			continue
+		}
+		ok, detail := c.check(r)
+		if msg, failed := r.Errors[c.subsystem]; failed {
+			ok, detail = false, msg
+		}
+		result := "PASS"
+		if !ok {
+			result = "FAIL"
+			if c.hard {
+				passed = false
+			} else {
+				result = "WARN"
+			}
+		}
+		fmt.Fprintf(w, "%s %s: %s\n", result, c.subsystem, detail)
+	}
+	return passed
+}
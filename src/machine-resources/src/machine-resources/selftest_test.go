@@ -0,0 +1,120 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lxc/lxd/shared/api"
+)
+
+// selfTestResources returns resources that pass all of sanityChecks.
+func selfTestResources() *machineResources {
+	return &machineResources{
+		CPU: &cpu{Sockets: []cpuSocket{
+			{Cores: make([]cpuCore, 4)},
+			{Cores: make([]cpuCore, 4)},
+		}},
+		Memory:  &memory{ResourcesMemory: api.ResourcesMemory{Total: 17179869184}},
+		Storage: &storage{Disks: make([]storageDisk, 2)},
+		Network: &network{Interfaces: make([]networkInterface, 3)},
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	all, err := selectSubsystems(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpuOnly, err := selectSubsystems([]string{"cpu"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		change   func(r *machineResources)
+		selected []subsystem
+		want     string
+		passed   bool
+	}{
+		{
+			name:     "sane",
+			change:   func(r *machineResources) {},
+			selected: all,
+			want: "PASS cpu: 8 cores\n" +
+				"PASS memory: 17179869184 bytes total\n" +
+				"PASS storage: 2 disks\n" +
+				"PASS network: 3 interfaces\n",
+			passed: true,
+		},
+		{
+			name:     "diskless",
+			change:   func(r *machineResources) { r.Storage.Disks = nil },
+			selected: all,
+			want: "PASS cpu: 8 cores\n" +
+				"PASS memory: 17179869184 bytes total\n" +
+				"PASS storage: no disks (diskless)\n" +
+				"PASS network: 3 interfaces\n",
+			passed: true,
+		},
+		{
+			// Storage is only a warning, so the report still passes.
+			name: "storage failed",
+			change: func(r *machineResources) {
+				r.Storage = nil
+				r.Errors = map[string]string{"storage": "lsblk: not found"}
+			},
+			selected: all,
+			want: "PASS cpu: 8 cores\n" +
+				"PASS memory: 17179869184 bytes total\n" +
+				"WARN storage: lsblk: not found\n" +
+				"PASS network: 3 interfaces\n",
+			passed: true,
+		},
+		{
+			name:     "no memory",
+			change:   func(r *machineResources) { r.Memory = nil },
+			selected: all,
+			want: "PASS cpu: 8 cores\n" +
+				"FAIL memory: 0 bytes total\n" +
+				"PASS storage: 2 disks\n" +
+				"PASS network: 3 interfaces\n",
+		},
+		{
+			// The collection error is reported even though there's
+			// something in the resources.
+			name:     "cpu failed",
+			change:   func(r *machineResources) { r.Errors = map[string]string{"cpu": "permission denied"} },
+			selected: all,
+			want: "FAIL cpu: permission denied\n" +
+				"PASS memory: 17179869184 bytes total\n" +
+				"PASS storage: 2 disks\n" +
+				"PASS network: 3 interfaces\n",
+		},
+		{
+			name:     "not collected",
+			change:   func(r *machineResources) { r.Memory, r.Storage, r.Network = nil, nil, nil },
+			selected: cpuOnly,
+			want: "PASS cpu: 8 cores\n" +
+				"SKIP memory: not collected\n" +
+				"SKIP storage: not collected\n" +
+				"SKIP network: not collected\n",
+			passed: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := selfTestResources()
+			test.change(r)
+			var buf bytes.Buffer
+			if passed := selfTest(&buf, sanityChecks, r, test.selected); passed != test.passed {
+				t.Errorf("selfTest() = %v, want %v", passed, test.passed)
+			}
+			if buf.String() != test.want {
+				t.Errorf("selfTest() wrote\n%s\nwant\n%s", buf.String(), test.want)
+			}
+		})
+	}
+}
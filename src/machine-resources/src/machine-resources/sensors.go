@@ -0,0 +1,91 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sensor types, as reported in sensors.*.type.
+const (
+	sensorTemperature = "temperature"
+	sensorFan         = "fan"
+)
+
+// sensorReading is one hwmon sensor's value at collection time, in degrees
+// Celsius for temperatures and RPM for fans.
+type sensorReading struct {
+	Chip  string  `json:"chip" yaml:"chip"`
+	Label string  `json:"label" yaml:"label"`
+	Type  string  `json:"type" yaml:"type"`
+	Value float64 `json:"value" yaml:"value"`
+}
+
+// hwmonInput matches the hwmon input files we read, such as temp1_input.
+var hwmonInput = regexp.MustCompile(`^(temp|fan)([0-9]+)_input$`)
+
+// getSensors reads the temperature and fan sensors of every hwmon device.
+func getSensors() ([]sensorReading, error) {
+	dirs, err := filepath.Glob(sysfsPath("class/hwmon/hwmon*"))
+	if err != nil {
+		return nil, err
+	}
+	var readings []sensorReading
+	for _, dir := range dirs {
+		chip, _ := readString(filepath.Join(dir, "name"))
+		if chip == "" {
+			chip = filepath.Base(dir)
+		}
+		inputs, _ := filepath.Glob(filepath.Join(dir, "*_input"))
+		var chipReadings []sensorReading
+		for _, input := range inputs {
+			match := hwmonInput.FindStringSubmatch(filepath.Base(input))
+			if match == nil {
+				continue
+			}
+			raw, err := readString(input)
+			if err != nil {
+				continue
+			}
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				continue
+			}
+			prefix := match[1] + match[2]
+			label, _ := readString(filepath.Join(dir, prefix+"_label"))
+			if label == "" {
+				label = prefix
+			}
+			reading := sensorReading{Chip: chip, Label: label, Value: value}
+			if match[1] == "temp" {
+				// hwmon reports millidegrees.
+				reading.Type = sensorTemperature
+				reading.Value = value / 1000
+			} else {
+				reading.Type = sensorFan
+			}
+			chipReadings = append(chipReadings, reading)
+		}
+		sort.Slice(chipReadings, func(i, j int) bool {
+			return naturalLess(chipReadings[i].Label, chipReadings[j].Label)
+		})
+		readings = append(readings, chipReadings...)
+	}
+	return readings, nil
+}
+
+// naturalLess compares strings so that "Core 2" sorts before "Core 10".
+func naturalLess(a, b string) bool {
+	ta, tb := strings.TrimRight(a, "0123456789"), strings.TrimRight(b, "0123456789")
+	if ta != tb {
+		return a < b
+	}
+	na, _ := strconv.Atoi(a[len(ta):])
+	nb, _ := strconv.Atoi(b[len(tb):])
+	return na < nb
+}
@@ -0,0 +1,40 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestGetSensors(t *testing.T) {
+	useRoots(t, "testdata/sensors")
+	readings, err := getSensors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []sensorReading{
+		{Chip: "coretemp", Label: "Core 0", Type: sensorTemperature, Value: 41},
+		{Chip: "coretemp", Label: "Core 2", Type: sensorTemperature, Value: 40.5},
+		{Chip: "coretemp", Label: "Core 10", Type: sensorTemperature, Value: 43},
+		{Chip: "coretemp", Label: "Package id 0", Type: sensorTemperature, Value: 45},
+		// Voltages and unreadable inputs are skipped.
+		{Chip: "nct6775", Label: "fan1", Type: sensorFan, Value: 1200},
+		{Chip: "nct6775", Label: "fan2", Type: sensorFan, Value: 0},
+		{Chip: "hwmon2", Label: "temp1", Type: sensorTemperature, Value: 38},
+	}
+	if !reflect.DeepEqual(readings, want) {
+		t.Errorf("getSensors() =\n%+v\nwant\n%+v", readings, want)
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	labels := []string{"Core 10", "temp2", "Core 2", "Core 1", "temp10", "Package id 0"}
+	sort.Slice(labels, func(i, j int) bool { return naturalLess(labels[i], labels[j]) })
+	want := []string{"Core 1", "Core 2", "Core 10", "Package id 0", "temp2", "temp10"}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("sorted %v, want %v", labels, want)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// errBadSignature is returned by verifyReport when a report's signature
+// doesn't match its contents.
+var errBadSignature = errors.New("signature doesn't match the report")
+
+// signedBytes returns what a signature covers: the generic form of the
+// report encoded as JSON, whose map keys encoding/json sorts. The same
+// bytes are produced from a report read back in, whatever its indentation.
+func signedBytes(report interface{}) ([]byte, error) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	generic, err := decodeExact(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
+
+// loadSigningKey reads an Ed25519 private key, either PKCS#8 PEM as written
+// by `openssl genpkey -algorithm ed25519` or an unencrypted OpenSSH key.
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ssh.ParseRawPrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key %s: %v", path, err)
+	}
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		return key, nil
+	case *ed25519.PrivateKey:
+		return *key, nil
+	}
+	return nil, fmt.Errorf("invalid signing key %s: not an Ed25519 key", path)
+}
+
+// loadVerifyingKey reads an Ed25519 public key, either PKIX PEM or a line
+// in authorized_keys format.
+func loadVerifyingKey(path string) (ed25519.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var key interface{}
+	if block, _ := pem.Decode(data); block != nil {
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	} else {
+		var sshKey ssh.PublicKey
+		sshKey, _, _, _, err = ssh.ParseAuthorizedKey(data)
+		if err == nil {
+			// Certificates don't expose their key this way.
+			cryptoKey, ok := sshKey.(ssh.CryptoPublicKey)
+			if !ok {
+				return nil, fmt.Errorf("invalid public key %s: %s isn't a plain key", path, sshKey.Type())
+			}
+			key = cryptoKey.CryptoPublicKey()
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %s: %v", path, err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid public key %s: not an Ed25519 key", path)
+	}
+	return public, nil
+}
+
+// signReport returns the base64 encoded signature of the report as it's
+// emitted: the envelope, which must not have its signature set yet, or the
+// bare resources.
+func signReport(key ed25519.PrivateKey, report interface{}) (string, error) {
+	data, err := signedBytes(report)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)), nil
+}
+
+// verifyReport checks the signature of a JSON report written with --sign,
+// compressed or not.// The signature is taken from the envelope if it has one, and otherwise
+// from the detached signature file next to the report. It covers the whole
+// report other than the signature itself, so changing the envelope's
+// fingerprint or API version breaks it just as changing the resources does.
+func verifyReport(key ed25519.PublicKey, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// The signature is of the report before --compress.
+	data, err = decompress(data)
+	if err != nil {
+		return fmt.Errorf("invalid report %s: %v", path, err)
+	}
+	report, err := decodeExact(data)
+	if err != nil {
+		return fmt.Errorf("invalid report %s: %v", path, err)
+	}
+	var signature string
+	if m, ok := report.(map[string]interface{}); ok {
+		if _, wrapped := m["api_version"]; wrapped {
+			signature, _ = m["signature"].(string)
+			delete(m, "signature")
+		}
+	}
+	if signature == "" {
+		detached, err := ioutil.ReadFile(path + ".sig")
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s isn't signed", path)
+		}
+		if err != nil {
+			return err
+		}
+		signature = strings.TrimSpace(string(detached))
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature for %s: %v", path, err)
+	}
+	signed, err := signedBytes(report)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, signed, sig) {
+		return errBadSignature
+	}
+	return nil
+}
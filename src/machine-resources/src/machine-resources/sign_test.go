@@ -0,0 +1,283 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// writeKeyPair writes a new Ed25519 key pair to dir as PKCS#8 and PKIX PEM,
+// returning their paths and the public key.
+func writeKeyPair(t *testing.T, dir string) (string, string, ed25519.PublicKey) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privatePath := filepath.Join(dir, "key.pem")
+	publicPath := filepath.Join(dir, "key.pub.pem")
+	writeTestFile(t, privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	writeTestFile(t, publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	return privatePath, publicPath, public
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testReport returns an envelope as main would emit it, unsigned.
+func testReport() *envelope {
+	return &envelope{
+		APIVersion:  apiVersion,
+		Fingerprint: "0123abcd",
+		Resources: &machineResources{
+			Identifiers: &identifiers{MachineID: "4f0c5b5e2d6a4e0f9f6b2c8d7e1a3b5c"},
+			Sensors:     []sensorReading{{Chip: "coretemp", Label: "Package id 0", Type: "temperature", Value: 42}},
+		},
+	}
+}
+
+// writeSignedReport signs report with the key at keyPath, embeds the
+// signature and writes it to path.
+func writeSignedReport(t *testing.T, keyPath, path string, report *envelope) {
+	t.Helper()
+	key, err := loadSigningKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report.Signature, err = signReport(key, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := marshalers["json"](report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, path, data)
+}
+
+func TestVerifyReportRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	privatePath, publicPath, _ := writeKeyPair(t, dir)
+	reportPath := filepath.Join(dir, "report.json")
+	writeSignedReport(t, privatePath, reportPath, testReport())
+	key, err := loadVerifyingKey(publicPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyReport(key, reportPath); err != nil {
+		t.Fatalf("verifyReport() = %v, want nil", err)
+	}
+}
+
+// --compress is applied after --sign, so the signature is of the report
+// before it's compressed, whether embedded or detached.
+func TestVerifyReportCompressed(t *testing.T) {
+	dir := t.TempDir()
+	privatePath, _, public := writeKeyPair(t, dir)
+	key, err := loadSigningKey(privatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"gzip", "zstd"} {
+		t.Run(name, func(t *testing.T) {
+			embeddedPath := filepath.Join(dir, name+"-embedded.json")
+			writeSignedReport(t, privatePath, embeddedPath, testReport())
+			detachedPath := filepath.Join(dir, name+"-detached.json")
+			report := testReport()
+			signature, err := signReport(key, report)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := marshalers["json"](report)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeTestFile(t, detachedPath, data)
+			writeTestFile(t, detachedPath+".sig", []byte(signature+"\n"))
+			for _, path := range []string{embeddedPath, detachedPath} {
+				compressed, err := compress(name, readTestFile(t, path))
+				if err != nil {
+					t.Fatal(err)
+				}
+				writeTestFile(t, path, compressed)
+				if err := verifyReport(public, path); err != nil {
+					t.Errorf("verifyReport(%s) = %v, want nil", filepath.Base(path), err)
+				}
+			}
+			tampered, err := compress(name, bytes.Replace(data, []byte("coretemp"), []byte("k10temp"), 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeTestFile(t, detachedPath, tampered)
+			if err := verifyReport(public, detachedPath); err != errBadSignature {
+				t.Errorf("verifyReport() of a changed report = %v, want %v", err, errBadSignature)
+			}
+		})
+	}
+}
+
+func TestVerifyReportAuthorizedKey(t *testing.T) {
+	dir := t.TempDir()
+	privatePath, _, public := writeKeyPair(t, dir)
+	sshKey, err := ssh.NewPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPath := filepath.Join(dir, "authorized_keys")
+	writeTestFile(t, publicPath, ssh.MarshalAuthorizedKey(sshKey))
+	reportPath := filepath.Join(dir, "report.json")
+	writeSignedReport(t, privatePath, reportPath, testReport())
+	key, err := loadVerifyingKey(publicPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyReport(key, reportPath); err != nil {
+		t.Fatalf("verifyReport() = %v, want nil", err)
+	}
+}
+
+func TestVerifyReportTampered(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(report map[string]interface{})
+	}{
+		{"fingerprint", func(report map[string]interface{}) {
+			report["fingerprint"] = "ffffffff"
+		}},
+		{"api_version", func(report map[string]interface{}) {
+			report["api_version"] = 2
+		}},
+		{"resources", func(report map[string]interface{}) {
+			resources := report["resources"].(map[string]interface{})
+			resources["identifiers"].(map[string]interface{})["machine_id"] = "0"
+		}},
+		{"added field", func(report map[string]interface{}) {
+			report["extra"] = true
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			privatePath, publicPath, public := writeKeyPair(t, dir)
+			reportPath := filepath.Join(dir, "report.json")
+			writeSignedReport(t, privatePath, reportPath, testReport())
+			data, err := ioutil.ReadFile(reportPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var report map[string]interface{}
+			if err := json.Unmarshal(data, &report); err != nil {
+				t.Fatal(err)
+			}
+			test.tamper(report)
+			if data, err = json.Marshal(report); err != nil {
+				t.Fatal(err)
+			}
+			writeTestFile(t, reportPath, data)
+			if err := verifyReport(public, reportPath); err != errBadSignature {
+				t.Fatalf("verifyReport(%s) = %v, want %v", publicPath, err, errBadSignature)
+			}
+		})
+	}
+}
+
+func TestVerifyReportWrongKey(t *testing.T) {
+	dir := t.TempDir()
+	privatePath, _, _ := writeKeyPair(t, dir)
+	reportPath := filepath.Join(dir, "report.json")
+	writeSignedReport(t, privatePath, reportPath, testReport())
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyReport(other, reportPath); err != errBadSignature {
+		t.Fatalf("verifyReport() = %v, want %v", err, errBadSignature)
+	}
+}
+
+func TestVerifyReportDetached(t *testing.T) {
+	dir := t.TempDir()
+	privatePath, _, public := writeKeyPair(t, dir)
+	key, err := loadSigningKey(privatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources := testReport().Resources
+	signature, err := signReport(key, resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := marshalers["json-compact"](resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reportPath := filepath.Join(dir, "report.json")
+	writeTestFile(t, reportPath, data)
+	if err := verifyReport(public, reportPath); err == nil || !strings.Contains(err.Error(), "isn't signed") {
+		t.Fatalf("verifyReport() without a signature = %v, want an unsigned error", err)
+	}
+	writeTestFile(t, reportPath+".sig", []byte(signature+"\n"))
+	if err := verifyReport(public, reportPath); err != nil {
+		t.Fatalf("verifyReport() = %v, want nil", err)
+	}
+	writeTestFile(t, reportPath, []byte(strings.Replace(string(data), "coretemp", "k10temp", 1)))
+	if err := verifyReport(public, reportPath); err != errBadSignature {
+		t.Fatalf("verifyReport() of a changed report = %v, want %v", err, errBadSignature)
+	}
+}
+
+func TestLoadVerifyingKeyCertificate(t *testing.T) {
+	dir := t.TempDir()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &ssh.Certificate{
+		Key:         signer.PublicKey(),
+		CertType:    ssh.UserCert,
+		ValidBefore: ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, signer); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "key-cert.pub")
+	writeTestFile(t, path, ssh.MarshalAuthorizedKey(cert))
+	if _, err := loadVerifyingKey(path); err == nil {
+		t.Fatal("loadVerifyingKey() of a certificate succeeded, want an error")
+	}
+}
+
+func TestLoadSigningKeyNotEd25519(t *testing.T) {
+	path := filepath.Join("testdata", "sign", "rsa.pem")
+	if _, err := loadSigningKey(path); err == nil || !strings.Contains(err.Error(), "not an Ed25519 key") {
+		t.Fatalf("loadSigningKey(%s) = %v, want a not Ed25519 error", path, err)
+	}
+}
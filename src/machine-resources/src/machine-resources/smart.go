@@ -0,0 +1,92 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"encoding/json"
+	"os/exec"
+)
+
+// ATA attribute ID of the reallocated sector count.
+const ataReallocatedSectors = 5
+
+// smartInfo is the SMART health summary of a disk.
+type smartInfo struct {
+	Health             string  `json:"health" yaml:"health"`
+	PowerOnHours       *uint64 `json:"power_on_hours,omitempty" yaml:"power_on_hours,omitempty"`
+	ReallocatedSectors *uint64 `json:"reallocated_sectors,omitempty" yaml:"reallocated_sectors,omitempty"`
+	TemperatureCelsius *int64  `json:"temperature_celsius,omitempty" yaml:"temperature_celsius,omitempty"`
+}
+
+// smartctlOutput is the part of `smartctl --json` output we use.
+type smartctlOutput struct {
+	SmartStatus *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	PowerOnTime *struct {
+		Hours uint64 `json:"hours"`
+	} `json:"power_on_time"`
+	Temperature *struct {
+		Current int64 `json:"current"`
+	} `json:"temperature"`
+	ATASmartAttributes *struct {
+		Table []struct {
+			ID  int `json:"id"`
+			Raw struct {
+				Value uint64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
+}
+
+// parseSmartctl parses `smartctl --json` output, returning nil if the
+// device doesn't report SMART health.
+func parseSmartctl(data []byte) (*smartInfo, error) {
+	var out smartctlOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	if out.SmartStatus == nil {
+		return nil, nil
+	}
+	info := &smartInfo{Health: "FAILED"}
+	if out.SmartStatus.Passed {
+		info.Health = "PASSED"
+	}
+	if out.PowerOnTime != nil {
+		info.PowerOnHours = &out.PowerOnTime.Hours
+	}
+	if out.Temperature != nil {
+		info.TemperatureCelsius = &out.Temperature.Current
+	}
+	if out.ATASmartAttributes != nil {
+		for _, attr := range out.ATASmartAttributes.Table {
+			if attr.ID == ataReallocatedSectors {
+				value := attr.Raw.Value
+				info.ReallocatedSectors = &value
+			}
+		}
+	}
+	return info, nil
+}
+
+// getSMART returns the SMART health of the named block device, or nil if
+// smartctl isn't available or the device doesn't support SMART.
+func getSMART(run commandRunner, device string) *smartInfo {
+	data, err := run("smartctl", "--json", "--health", "--attributes", "/dev/"+device)
+	if err != nil {
+		// smartctl sets the low bits of its exit status when it couldn't
+		// talk to the device at all. Higher bits report on disk health, and
+		// the output is still valid.
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok || exitErr.ExitCode()&0x3 != 0 {
+			return nil
+		}
+	}
+	info, err := parseSmartctl(data)
+	if err != nil {
+		return nil
+	}
+	return info
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func uint64Ptr(v uint64) *uint64 { return &v }
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func TestParseSmartctl(t *testing.T) {
+	tests := []struct {
+		file string
+		want *smartInfo
+	}{
+		{"sata.json", &smartInfo{
+			Health:             "PASSED",
+			PowerOnHours:       uint64Ptr(21034),
+			ReallocatedSectors: uint64Ptr(0),
+			TemperatureCelsius: int64Ptr(33),
+		}},
+		{"sata-failing.json", &smartInfo{
+			Health:             "FAILED",
+			PowerOnHours:       uint64Ptr(52611),
+			ReallocatedSectors: uint64Ptr(3912),
+		}},
+		{"nvme.json", &smartInfo{
+			Health:             "PASSED",
+			PowerOnHours:       uint64Ptr(8764),
+			TemperatureCelsius: int64Ptr(41),
+		}},
+		{"usb-bridge.json", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			info, err := parseSmartctl(readTestFile(t, "testdata/smart/"+test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(info, test.want) {
+				t.Errorf("parseSmartctl() = %+v, want %+v", info, test.want)
+			}
+		})
+	}
+}
+
+func TestGetSMART(t *testing.T) {
+	command := "smartctl --json --health --attributes /dev/"
+	run := fakeRunner(map[string]fakeCommand{
+		command + "sda": {readTestFile(t, "testdata/smart/sata.json"), nil},
+		// A failing disk sets a health bit of the exit status.
+		command + "sdb": {readTestFile(t, "testdata/smart/sata-failing.json"), exitError(t, 8, "")},
+		// Not being able to open the device sets a low bit.
+		command + "sdc": {readTestFile(t, "testdata/smart/usb-bridge.json"), exitError(t, 1, "")},
+		command + "sdd": {[]byte("smartctl 7.2 2020-12-30 r5155"), nil},
+	})
+	tests := []struct {
+		device     string
+		wantHealth string
+	}{
+		{"sda", "PASSED"},
+		{"sdb", "FAILED"},
+		{"sdc", ""},
+		{"sdd", ""},
+		{"sde", ""},
+	}
+	for _, test := range tests {
+		info := getSMART(run, test.device)
+		if test.wantHealth == "" {
+			if info != nil {
+				t.Errorf("getSMART(%s) = %+v, want nil", test.device, info)
+			}
+		} else if info == nil || info.Health != test.wantHealth {
+			t.Errorf("getSMART(%s) = %+v, want health %s", test.device, info, test.wantHealth)
+		}
+	}
+}
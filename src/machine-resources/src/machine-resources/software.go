@@ -0,0 +1,93 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// osReleasePaths are where os-release(5) is looked for, in order.
+var osReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+// systemSoftware is the running kernel and operating system, and whether
+// the firmware only lets it boot signed code. Fields that can't be
+// determined are omitted; SecureBoot is also in the firmware section, but
+// is here too so that it's reported with --exclude firmware.
+type systemSoftware struct {
+	KernelRelease string `json:"kernel_release,omitempty" yaml:"kernel_release,omitempty"`
+	KernelCmdline string `json:"kernel_cmdline,omitempty" yaml:"kernel_cmdline,omitempty"`
+	OSName        string `json:"os_name,omitempty" yaml:"os_name,omitempty"`
+	OSVersion     string `json:"os_version,omitempty" yaml:"os_version,omitempty"`
+	SecureBoot    *bool  `json:"secure_boot,omitempty" yaml:"secure_boot,omitempty"`
+}
+
+// parseOSRelease parses an os-release(5) file into its variables. Values may
+// be single or double quoted, and blank lines and comments are skipped.
+func parseOSRelease(r io.Reader) (map[string]string, error) {
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		vars[strings.TrimSpace(key)] = unquoteOSReleaseValue(strings.TrimSpace(value))
+	}
+	return vars, scanner.Err()
+}
+
+// unquoteOSReleaseValue strips shell-style quoting from an os-release value.
+// Within double quotes, backslash escapes the next character.
+func unquoteOSReleaseValue(value string) string {
+	if len(value) < 2 {
+		return value
+	}
+	quote := value[0]
+	if (quote != '"' && quote != '\'') || value[len(value)-1] != quote {
+		return value
+	}
+	value = value[1 : len(value)-1]
+	if quote == '\'' {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// getSystemSoftware collects kernel and OS information, reading os-release
+// from the first of releasePaths that exists, and the secure boot state.
+func getSystemSoftware(releasePaths []string) (*systemSoftware, error) {
+	s := &systemSoftware{}
+	s.KernelRelease, _ = readString(procPath("sys/kernel/osrelease"))
+	s.KernelCmdline, _ = readString(procPath("cmdline"))
+	s.SecureBoot = readSecureBoot()
+	for _, path := range releasePaths {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		vars, err := parseOSRelease(f)
+		f.Close()
+		if err != nil {
+			continue
+		}
+		s.OSName = vars["NAME"]
+		s.OSVersion = vars["VERSION_ID"]
+		break
+	}
+	return s, nil
+}
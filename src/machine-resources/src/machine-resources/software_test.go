@@ -0,0 +1,73 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOSRelease(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]string
+	}{
+		{"unquoted", "ID=ubuntu\n", map[string]string{"ID": "ubuntu"}},
+		{"double quoted", `NAME="Ubuntu"`, map[string]string{"NAME": "Ubuntu"}},
+		{"single quoted", `NAME='Red Hat Enterprise Linux'`, map[string]string{"NAME": "Red Hat Enterprise Linux"}},
+		{"escaped", `PRETTY_NAME="Say \"hi\" \\ bye"`, map[string]string{"PRETTY_NAME": `Say "hi" \ bye`}},
+		{"comments and blanks", "# comment\n\nID=debian\n", map[string]string{"ID": "debian"}},
+		{"no value", "NOTHING\nID=arch\n", map[string]string{"ID": "arch"}},
+		{"mismatched quotes", `NAME="Ubuntu'`, map[string]string{"NAME": `"Ubuntu'`}},
+		{"empty value", `VERSION_ID=""`, map[string]string{"VERSION_ID": ""}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseOSRelease(strings.NewReader(test.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseOSRelease(%q) = %v, want %v", test.in, got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetSystemSoftware(t *testing.T) {
+	dir := filepath.Join("testdata", "software")
+	useRoots(t, dir)
+	got, err := getSystemSoftware([]string{
+		filepath.Join(dir, "missing-os-release"),
+		filepath.Join(dir, "os-release"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &systemSoftware{
+		KernelRelease: "5.15.0-91-generic",
+		KernelCmdline: "BOOT_IMAGE=/vmlinuz-5.15.0-91-generic root=/dev/sda1 ro quiet",
+		OSName:        "Ubuntu",
+		OSVersion:     "22.04",
+		SecureBoot:    boolPtr(false),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getSystemSoftware() = %+v, want %+v", got, want)
+	}
+}
+
+func TestGetSystemSoftwareBIOS(t *testing.T) {
+	// Without EFI there's no secure boot state to report.
+	useRoots(t, "testdata/firmware/bios")
+	got, err := getSystemSoftware(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SecureBoot != nil {
+		t.Errorf("secure_boot = %v on a BIOS machine, want none", *got.SecureBoot)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lxc/lxd/lxd/resources"
+	"github.com/lxc/lxd/shared/api"
+)
+
+// storage is the LXD storage information, with our own details added to
+// each disk.
+type storage struct {
+	Disks []storageDisk `json:"disks" yaml:"disks"`
+	Total uint64        `json:"total" yaml:"total"`
+}
+
+// Disk media types, as reported in storage.disks.*.media.
+const (
+	mediaHDD  = "hdd"
+	mediaSSD  = "ssd"
+	mediaNVMe = "nvme"
+)
+
+// storageDisk is a disk as reported by LXD, with its queue settings from
+// sysfs and its partitions. Loopback and removable disks are marked so that
+// consumers can skip them, and disks in use so that they aren't clobbered.
+type storageDisk struct {
+	api.ResourcesStorageDisk `yaml:",inline"`
+	Media                    string             `json:"media,omitempty" yaml:"media,omitempty"`
+	Rotational               *bool              `json:"rotational,omitempty" yaml:"rotational,omitempty"`
+	Scheduler                string             `json:"scheduler,omitempty" yaml:"scheduler,omitempty"`
+	LogicalBlockSize         uint64             `json:"logical_block_size,omitempty" yaml:"logical_block_size,omitempty"`
+	PhysicalBlockSize        uint64             `json:"physical_block_size,omitempty" yaml:"physical_block_size,omitempty"`
+	Loopback                 bool               `json:"loopback,omitempty" yaml:"loopback,omitempty"`
+	SMART                    *smartInfo         `json:"smart,omitempty" yaml:"smart,omitempty"`
+	Partitions               []storagePartition `json:"partitions,omitempty" yaml:"partitions,omitempty"`
+	HasMounts                bool               `json:"has_mounts" yaml:"has_mounts"`
+}
+
+// MarshalYAML marshals the disk by way of its JSON. Partitions replaces the
+// embedded LXD field of the same name, which encoding/json allows but
+// yaml.v2 rejects for inlined structs.
+func (d storageDisk) MarshalYAML() (interface{}, error) {
+	return yamlViaJSON(d)
+}
+
+// parseScheduler returns the active scheduler from a queue/scheduler file,
+// which lists the available ones with the active one in brackets, as in
+// "mq-deadline kyber [bfq] none".
+func parseScheduler(schedulers string) string {
+	fields := strings.Fields(schedulers)
+	for _, field := range fields {
+		if strings.HasPrefix(field, "[") && strings.HasSuffix(field, "]") {
+			return strings.Trim(field, "[]")
+		}
+	}
+	if len(fields) == 1 {
+		return fields[0]
+	}
+	return ""
+}
+
+// addQueueDetails fills in disk's media type and queue settings from its
+// sysfs block directory.
+func addQueueDetails(disk *storageDisk) {
+	dir := sysfsPath("block", disk.ID)
+	queue := filepath.Join(dir, "queue")
+	if rotational, err := readString(filepath.Join(queue, "rotational")); err == nil {
+		value := rotational == "1"
+		disk.Rotational = &value
+		disk.Media = mediaSSD
+		if value {
+			disk.Media = mediaHDD
+		}
+	}
+	if strings.HasPrefix(disk.ID, "nvme") {
+		disk.Media = mediaNVMe
+	}
+	if schedulers, err := readString(filepath.Join(queue, "scheduler")); err == nil {
+		disk.Scheduler = parseScheduler(schedulers)
+	}
+	if size, err := readString(filepath.Join(queue, "logical_block_size")); err == nil {
+		disk.LogicalBlockSize, _ = strconv.ParseUint(size, 10, 64)
+	}
+	if size, err := readString(filepath.Join(queue, "physical_block_size")); err == nil {
+		disk.PhysicalBlockSize, _ = strconv.ParseUint(size, 10, 64)
+	}
+	// Only loop devices have a loop directory.
+	disk.Loopback = strings.HasPrefix(disk.ID, "loop") || exists(filepath.Join(dir, "loop"))
+}
+
+func getStorage(opts *collectOptions) (*storage, error) {
+	lxdStorage, err := resources.GetStorage()
+	if err != nil {
+		return nil, err
+	}
+	s := &storage{
+		Disks: make([]storageDisk, len(lxdStorage.Disks)),
+		Total: lxdStorage.Total,
+	}
+	mounts := getMounts()
+	for i, disk := range lxdStorage.Disks {
+		s.Disks[i].ResourcesStorageDisk = disk
+		addQueueDetails(&s.Disks[i])
+		addPartitionDetails(&s.Disks[i], mounts, opts.run)
+		if opts.smart {
+			s.Disks[i].SMART = getSMART(opts.run, disk.ID)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"testing"
+
+	"github.com/lxc/lxd/shared/api"
+)
+
+func TestAddQueueDetails(t *testing.T) {
+	useRoots(t, "testdata/storage")
+	tests := []struct {
+		id         string
+		media      string
+		rotational bool
+		scheduler  string
+		logical    uint64
+		physical   uint64
+		loopback   bool
+	}{
+		{"sda", mediaHDD, true, "bfq", 512, 4096, false},
+		{"sdb", mediaSSD, false, "mq-deadline", 512, 512, false},
+		{"nvme0n1", mediaNVMe, false, "none", 4096, 4096, false},
+		{"loop0", mediaHDD, true, "none", 512, 512, true},
+	}
+	for _, test := range tests {
+		t.Run(test.id, func(t *testing.T) {
+			disk := storageDisk{ResourcesStorageDisk: api.ResourcesStorageDisk{ID: test.id}}
+			addQueueDetails(&disk)
+			if disk.Rotational == nil || *disk.Rotational != test.rotational {
+				t.Errorf("rotational = %v, want %t", disk.Rotational, test.rotational)
+			}
+			if disk.Media != test.media || disk.Scheduler != test.scheduler ||
+				disk.LogicalBlockSize != test.logical || disk.PhysicalBlockSize != test.physical ||
+				disk.Loopback != test.loopback {
+				t.Errorf("got media %s, scheduler %s, block sizes %d/%d, loopback %t",
+					disk.Media, disk.Scheduler, disk.LogicalBlockSize, disk.PhysicalBlockSize, disk.Loopback)
+			}
+		})
+	}
+}
+
+// Without a sysfs block directory, nothing is guessed.
+func TestAddQueueDetailsMissing(t *testing.T) {
+	useRoots(t, "testdata/storage")
+	disk := storageDisk{ResourcesStorageDisk: api.ResourcesStorageDisk{ID: "sdz"}}
+	addQueueDetails(&disk)
+	if disk.Rotational != nil || disk.Media != "" || disk.Scheduler != "" {
+		t.Errorf("got rotational %v, media %q, scheduler %q for a missing disk",
+			disk.Rotational, disk.Media, disk.Scheduler)
+	}
+}
+
+func TestParseScheduler(t *testing.T) {
+	for schedulers, want := range map[string]string{
+		"mq-deadline kyber [bfq] none": "bfq",
+		"[none] mq-deadline":           "none",
+		"none":                         "none",
+		"noop deadline cfq":            "",
+		"":                             "",
+	} {
+		if got := parseScheduler(schedulers); got != want {
+			t.Errorf("parseScheduler(%q) = %q, want %q", schedulers, got, want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// streamRecord is one line of --stream output: a subsystem's part of the
+// report, or why it couldn't be collected.
+type streamRecord struct {
+	Subsystem string      `json:"subsystem"`
+	Data      interface{} `json:"data,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// streamWriter writes each subsystem's resources to w as a JSON line as
+// soon as it's collected, redacting them first if rd isn't nil.
+type streamWriter struct {
+	w  io.Writer
+	rd *redactor
+
+	mu      sync.Mutex
+	stopped bool
+}
+
+// stop makes later writes do nothing. Once it returns, nothing more is
+// written to w, even by a collection still running in another goroutine.
+func (s *streamWriter) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+}
+
+// write is a collectOptions.collected function. The part of r for the
+// subsystem is found under its name, which is also its key in the report.
+func (s *streamWriter) write(name string, r *machineResources, collectErr error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return nil
+	}
+	record := streamRecord{Subsystem: name}
+	if collectErr != nil {
+		record.Error = collectErr.Error()
+	} else {
+		// Work on a copy, so that values aren't redacted twice as
+		// further subsystems are added to r.
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		var part machineResources
+		if err := json.Unmarshal(data, &part); err != nil {
+			return err
+		}
+		if s.rd != nil {
+			s.rd.redact(&part)
+		}
+		generic, err := toGeneric(&part)
+		if err != nil {
+			return err
+		}
+		if m, ok := generic.(map[string]interface{}); ok {
+			record.Data = m[name]
+		}
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
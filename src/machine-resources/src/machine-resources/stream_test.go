@@ -0,0 +1,95 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStreamWriterStopped(t *testing.T) {
+	var buf bytes.Buffer
+	sw := &streamWriter{w: &buf}
+	r := &machineResources{Virt: &virtualization{Type: virtBareMetal}}
+	if err := sw.write("virtualization", r, nil); err != nil {
+		t.Fatal(err)
+	}
+	sw.stop()
+	written := buf.Len()
+	if written == 0 {
+		t.Fatal("nothing written before stop()")
+	}
+	if err := sw.write("virtualization", r, nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != written {
+		t.Errorf("wrote %q after stop()", buf.String()[written:])
+	}
+}
+
+func TestStreamWriter(t *testing.T) {
+	var buf bytes.Buffer
+	sw := &streamWriter{w: &buf}
+	r := &machineResources{
+		Virt: &virtualization{Type: virtVM, Hypervisor: "kvm", Source: "dmi:sys_vendor"},
+	}
+	if err := sw.write("virtualization", r, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := sw.write("gpu", r, errors.New("nvidia-smi: not found")); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"subsystem":"virtualization","data":{"hypervisor":"kvm","source":"dmi:sys_vendor","type":"vm"}}
+{"subsystem":"gpu","error":"nvidia-smi: not found"}
+`
+	if buf.String() != want {
+		t.Errorf("wrote\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestStreamWriterRedacts(t *testing.T) {
+	rd, err := newRedactor("salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	sw := &streamWriter{w: &buf, rd: rd}
+	r, identifying := redactionTestResources()
+	// Each record is redacted from a copy, so r keeps its values however
+	// many subsystems are written from it.
+	for i := 0; i < 2; i++ {
+		if err := sw.write("storage", r, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 || lines[0] != lines[1] {
+		t.Fatalf("writing the same subsystem twice gave\n%s", buf.String())
+	}
+	for _, id := range identifying {
+		if strings.Contains(lines[0], id) {
+			t.Errorf("%q not redacted in %s", id, lines[0])
+		}
+	}
+	if r.Storage.Disks[0].Serial != "S3Z9NB0K123456A" {
+		t.Errorf("write() redacted the report itself")
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestStreamWriterWriteError(t *testing.T) {
+	sw := &streamWriter{w: failingWriter{}}
+	err := sw.write("gpu", &machineResources{}, nil)
+	if err == nil || err.Error() != "broken pipe" {
+		t.Errorf("write() error = %v, want broken pipe", err)
+	}
+}
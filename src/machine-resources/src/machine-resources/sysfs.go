@@ -0,0 +1,98 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sysfsRoot and procRoot are where our own collectors find sysfs and procfs,
+// so that they can be pointed at a fixture tree instead. In order of
+// precedence they're set by the --sysfs-root and --proc-root flags, then the
+// MAAS_SYSFS_ROOT and MAAS_PROC_ROOT environment variables, and otherwise
+// default to /sys and /proc. The LXD resources package always reads the real
+// ones.
+var (
+	sysfsRoot = "/sys"
+	procRoot  = "/proc"
+)
+
+// envOr returns the value of the environment variable key, or fallback if
+// it's unset or empty.
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// sysfsPath returns the path of elem under sysfsRoot.
+func sysfsPath(elem ...string) string {
+	return filepath.Join(append([]string{sysfsRoot}, elem...)...)
+}
+
+// procPath returns the path of elem under procRoot.
+func procPath(elem ...string) string {
+	return filepath.Join(append([]string{procRoot}, elem...)...)
+}
+
+// readString returns the contents of a sysfs or procfs file without
+// surrounding whitespace.
+func readString(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// readUint reads an unsigned integer from a sysfs file.
+func readUint(path string) (uint64, error) {
+	value, err := readString(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// readOptionalUint is readUint for optional fields, returning nil if the
+// file is missing or invalid.
+func readOptionalUint(path string) *uint64 {
+	value, err := readUint(path)
+	if err != nil {
+		return nil
+	}
+	return &value
+}
+
+// parseCPUList parses a kernel CPU list such as "0-3,8,10-11".
+func parseCPUList(list string) ([]uint64, error) {
+	var cpus []uint64
+	for _, item := range strings.Split(strings.TrimSpace(list), ",") {
+		if item == "" {
+			continue
+		}
+		bounds := strings.SplitN(item, "-", 2)
+		first, err := strconv.ParseUint(bounds[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU list %q", list)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.ParseUint(bounds[1], 10, 64)
+			if err != nil || last < first {
+				return nil, fmt.Errorf("invalid CPU list %q", list)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// useRoots points the collectors at the sys and proc trees under dir,
+// restoring the real ones when the test ends.
+func useRoots(t *testing.T, dir string) {
+	t.Helper()
+	sysfs, proc := sysfsRoot, procRoot
+	sysfsRoot, procRoot = filepath.Join(dir, "sys"), filepath.Join(dir, "proc")
+	t.Cleanup(func() { sysfsRoot, procRoot = sysfs, proc })
+}
+
+func TestFixtureRoots(t *testing.T) {
+	useRoots(t, "testdata/sysfs")
+	online, err := readString(sysfsPath("devices/system/cpu/online"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if online != "0-3,8,10-11" {
+		t.Errorf("read %q from the fixture sysfs", online)
+	}
+	release, err := readString(procPath("sys", "kernel", "osrelease"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release != "5.15.0-91-generic" {
+		t.Errorf("read %q from the fixture procfs", release)
+	}
+}
+
+func TestEnvOr(t *testing.T) {
+	t.Setenv("MAAS_SYSFS_ROOT", "")
+	if got := envOr("MAAS_SYSFS_ROOT", "/sys"); got != "/sys" {
+		t.Errorf("envOr() of an empty variable = %q, want the fallback", got)
+	}
+	t.Setenv("MAAS_SYSFS_ROOT", "/tmp/sys")
+	if got := envOr("MAAS_SYSFS_ROOT", "/sys"); got != "/tmp/sys" {
+		t.Errorf("envOr() = %q, want /tmp/sys", got)
+	}
+}
+
+func TestReadUint(t *testing.T) {
+	useRoots(t, "testdata/sysfs")
+	if value, err := readUint(sysfsPath("block/sda/queue/rotational")); err != nil || value != 1 {
+		t.Errorf("readUint() = %d, %v; want 1", value, err)
+	}
+	if value := readOptionalUint(sysfsPath("block/sda/queue/max_sectors_kb")); value != nil {
+		t.Errorf("readOptionalUint() of %q = %d, want nil", "none", *value)
+	}
+	if value := readOptionalUint(sysfsPath("block/sda/queue/missing")); value != nil {
+		t.Errorf("readOptionalUint() of a missing file = %d, want nil", *value)
+	}
+}
+
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []uint64
+		wantErr bool
+	}{
+		{list: "0-3,8,10-11\n", want: []uint64{0, 1, 2, 3, 8, 10, 11}},
+		{list: "5", want: []uint64{5}},
+		{list: ""},
+		{list: "3-1", wantErr: true},
+		{list: "0-x", wantErr: true},
+		{list: "a", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseCPUList(test.list)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseCPUList(%q) error = %v, want error %t", test.list, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseCPUList(%q) = %v, want %v", test.list, got, test.want)
+		}
+	}
+}
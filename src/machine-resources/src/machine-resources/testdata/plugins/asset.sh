@@ -0,0 +1,3 @@
+#!/bin/sh
+echo "can't reach the asset database" >&2
+exit 1
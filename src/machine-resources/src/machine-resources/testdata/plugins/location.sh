@@ -0,0 +1,2 @@
+#!/bin/sh
+echo '{"rack": "r12", "slot": 4}'
@@ -0,0 +1,163 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// usbIDsPaths are where usb.ids is looked for, in order.
+var usbIDsPaths = []string{
+	"/usr/share/misc/usb.ids",
+	"/var/lib/usbutils/usb.ids",
+	"/usr/share/hwdata/usb.ids",
+}
+
+// usb is the USB devices attached to the machine.
+type usb struct {
+	Devices []usbDevice `json:"devices" yaml:"devices"`
+	Total   uint64      `json:"total" yaml:"total"`
+}
+
+type usbDevice struct {
+	ID            string `json:"id" yaml:"id"`
+	BusAddress    string `json:"bus_address" yaml:"bus_address"`
+	DeviceAddress string `json:"device_address" yaml:"device_address"`
+	VendorID      string `json:"vendor_id" yaml:"vendor_id"`
+	ProductID     string `json:"product_id" yaml:"product_id"`
+	VendorName    string `json:"vendor_name,omitempty" yaml:"vendor_name,omitempty"`
+	ProductName   string `json:"product_name,omitempty" yaml:"product_name,omitempty"`
+	Speed         string `json:"speed,omitempty" yaml:"speed,omitempty"`
+}
+
+// usbIDs is a parsed usb.ids database. Products are keyed by
+// "vendor:product".
+type usbIDs struct {
+	vendors  map[string]string
+	products map[string]string
+}
+
+// parseUSBIDs parses the vendor and product part of a usb.ids database.
+// Vendors are unindented, their products follow indented by a tab, and the
+// device class and other lists that come after all vendors are ignored.
+func parseUSBIDs(r io.Reader) (*usbIDs, error) {
+	ids := &usbIDs{
+		vendors:  make(map[string]string),
+		products: make(map[string]string),
+	}
+	var vendor string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "\t\t") {
+			// Interfaces aren't reported.
+			continue
+		}
+		if strings.HasPrefix(line, "\t") {
+			if vendor == "" {
+				continue
+			}
+			id, name, ok := splitUSBIDsLine(line[1:])
+			if ok {
+				ids.products[vendor+":"+id] = name
+			}
+			continue
+		}
+		id, name, ok := splitUSBIDsLine(line)
+		if !ok {
+			// The first non-vendor section, e.g. "C 00  ...", ends the
+			// vendor list.
+			break
+		}
+		vendor = id
+		ids.vendors[id] = name
+	}
+	return ids, scanner.Err()
+}
+
+// splitUSBIDsLine splits an "xxxx  name" line, where xxxx is a hex ID.
+func splitUSBIDsLine(line string) (string, string, bool) {
+	if len(line) < 6 || line[4:6] != "  " {
+		return "", "", false
+	}
+	id := strings.ToLower(line[:4])
+	if strings.Trim(id, "0123456789abcdef") != "" {
+		return "", "", false
+	}
+	return id, strings.TrimSpace(line[6:]), true
+}
+
+// loadUSBIDs parses the first usb.ids found in paths, or returns nil if
+// there is none.
+func loadUSBIDs(paths []string) *usbIDs {
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		ids, err := parseUSBIDs(f)
+		f.Close()
+		if err == nil {
+			return ids
+		}
+	}
+	return nil
+}
+
+// lookup returns the vendor and product names of the given IDs, or empty
+// strings for those it doesn't know.
+func (ids *usbIDs) lookup(vendor, product string) (string, string) {
+	if ids == nil {
+		return "", ""
+	}
+	vendor = strings.ToLower(vendor)
+	product = strings.ToLower(product)
+	return ids.vendors[vendor], ids.products[vendor+":"+product]
+}
+
+// getUSB enumerates USB devices from sysfs, resolving their names with the
+// usb.ids database found in idsPaths.
+func getUSB(idsPaths []string) (*usb, error) {
+	dirs, err := filepath.Glob(sysfsPath("bus/usb/devices/*"))
+	if err != nil {
+		return nil, err
+	}
+	ids := loadUSBIDs(idsPaths)
+	u := &usb{Devices: []usbDevice{}}
+	for _, dir := range dirs {
+		// Only devices have IDs; interfaces ("1-1:1.0") don't.
+		vendorID, err := readString(filepath.Join(dir, "idVendor"))
+		if err != nil {
+			continue
+		}
+		productID, _ := readString(filepath.Join(dir, "idProduct"))
+		busNum, _ := readString(filepath.Join(dir, "busnum"))
+		devNum, _ := readString(filepath.Join(dir, "devnum"))
+		speed, _ := readString(filepath.Join(dir, "speed"))
+		vendorName, productName := ids.lookup(vendorID, productID)
+		u.Devices = append(u.Devices, usbDevice{
+			ID:            filepath.Base(dir),
+			BusAddress:    busNum,
+			DeviceAddress: devNum,
+			VendorID:      vendorID,
+			ProductID:     productID,
+			VendorName:    vendorName,
+			ProductName:   productName,
+			Speed:         speed,
+		})
+	}
+	sort.Slice(u.Devices, func(i, j int) bool {
+		return u.Devices[i].ID < u.Devices[j].ID
+	})
+	u.Total = uint64(len(u.Devices))
+	return u, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestGetUSB(t *testing.T) {
+	useRoots(t, "testdata/usb")
+	u, err := getUSB([]string{"testdata/usb/missing.ids", "testdata/usb/usb.ids"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &usb{
+		Devices: []usbDevice{
+			{
+				ID: "1-1", BusAddress: "1", DeviceAddress: "4", VendorID: "046D", ProductID: "c52b",
+				VendorName: "Logitech, Inc.", ProductName: "Unifying Receiver", Speed: "12",
+			},
+			// Unknown products keep their vendor's name.
+			{
+				ID: "1-2", BusAddress: "1", DeviceAddress: "7", VendorID: "0bda", ProductID: "9999",
+				VendorName: "Realtek Semiconductor Corp.", Speed: "480",
+			},
+			{
+				ID: "usb1", BusAddress: "1", DeviceAddress: "1", VendorID: "1d6b", ProductID: "0002",
+				VendorName: "Linux Foundation", ProductName: "2.0 root hub", Speed: "480",
+			},
+		},
+		Total: 3,
+	}
+	if !reflect.DeepEqual(u, want) {
+		t.Errorf("getUSB() = %+v, want %+v", u, want)
+	}
+}
+
+func TestGetUSBWithoutIDs(t *testing.T) {
+	useRoots(t, "testdata/usb")
+	u, err := getUSB(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, device := range u.Devices {
+		if device.VendorName != "" || device.ProductName != "" {
+			t.Errorf("device %s has names %q and %q without usb.ids", device.ID, device.VendorName, device.ProductName)
+		}
+	}
+}
+
+func TestParseUSBIDsStopsAtClasses(t *testing.T) {
+	f, err := os.Open("testdata/usb/usb.ids")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ids, err := parseUSBIDs(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids.vendors) != 3 || len(ids.products) != 5 {
+		t.Errorf("parsed %d vendors and %d products, want 3 and 5", len(ids.vendors), len(ids.products))
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// resourcesSchema is the JSON Schema the resources must conform to for
+// MAAS to process them.
+//
+//go:embed schema.json
+var resourcesSchema []byte
+
+// validateResources checks r against resourcesSchema, returning a
+// description of each problem found.
+func validateResources(r *machineResources) ([]string, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	result, err := gojsonschema.Validate(
+		gojsonschema.NewBytesLoader(resourcesSchema),
+		gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	for _, e := range result.Errors() {
+		problems = append(problems, fmt.Sprintf("%s: %s", e.Field(), e.Description()))
+	}
+	return problems, nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateResources(t *testing.T) {
+	r, _ := redactionTestResources()
+	r.NUMA = []numaNode{{NodeID: 0, CPUs: []uint64{0, 1}, MemoryBytes: 8589934592}}
+	r.Virt = &virtualization{Type: virtVM, Hypervisor: "kvm"}
+	r.Firmware = &firmware{Type: "uefi"}
+	r.Boot = &boot{BootTime: "2019-06-01T12:00:00Z", UptimeSeconds: 3600.5}
+	problems, err := validateResources(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("valid resources have problems: %v", problems)
+	}
+}
+
+func TestValidateResourcesInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		r    *machineResources
+		want string
+	}{
+		{"unknown virtualization", &machineResources{Virt: &virtualization{Type: "none"}}, "virtualization.type"},
+		{"unknown firmware", &machineResources{Firmware: &firmware{Type: "coreboot"}}, "firmware.type"},
+		{"unknown media", &machineResources{Storage: &storage{Disks: []storageDisk{{Media: "floppy"}}}}, "storage.disks.0.media"},
+		{"bad boot time", &machineResources{Boot: &boot{BootTime: "yesterday"}}, "boot.boot_time"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems, err := validateResources(test.r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(problems) != 1 || !strings.HasPrefix(problems[0], test.want+": ") {
+				t.Errorf("problems = %v, want one with %s", problems, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Virtualization types, as reported in virtualization.type.
+const (
+	virtBareMetal = "bare-metal"
+	virtVM        = "vm"
+	virtContainer = "container"
+)
+
+// virtualization describes the environment machine-resources runs in.
+// Source names the signal the detection was based on, the same whichever
+// roots were read: "file:", "proc:" or "sysfs:" and a path relative to /,
+// /proc or /sys, "dmi:" and the DMI field, or a tag such as
+// "cpuinfo:hypervisor" for a value found within a file.
+type virtualization struct {
+	Type       string `json:"type" yaml:"type"`
+	Hypervisor string `json:"hypervisor,omitempty" yaml:"hypervisor,omitempty"`
+	Container  string `json:"container,omitempty" yaml:"container,omitempty"`
+	Source     string `json:"source,omitempty" yaml:"source,omitempty"`
+}
+
+// dmiHypervisors maps DMI vendor and product strings to hypervisors, in the
+// order they're checked. These follow systemd-detect-virt.
+var dmiHypervisors = []struct {
+	prefix     string
+	hypervisor string
+}{
+	{"KVM", "kvm"},
+	{"QEMU", "qemu"},
+	{"VMware", "vmware"},
+	{"VMW", "vmware"},
+	{"innotek GmbH", "oracle"},
+	{"Oracle Corporation", "oracle"},
+	{"Xen", "xen"},
+	{"Bochs", "bochs"},
+	{"Parallels", "parallels"},
+	{"BHYVE", "bhyve"},
+	{"Amazon EC2", "amazon"},
+	{"Google", "google"},
+}
+
+// dmiVirtFields are the DMI files checked against dmiHypervisors.
+var dmiVirtFields = []string{
+	"product_name", "sys_vendor", "board_vendor", "bios_vendor",
+}
+
+// detectContainer returns the kind of container we're running in and the
+// source of the file that gave it away, or empty strings if we're not in one. The marker
+// files container managers leave outside sysfs and procfs are looked for
+// under root, which is normally "/".
+func detectContainer(root string) (string, string) {
+	if name, err := readString(filepath.Join(root, "run/systemd/container")); err == nil && name != "" {
+		return name, "file:run/systemd/container"
+	}
+	// PID 1's environment is only readable by root.
+	if environ, err := ioutil.ReadFile(procPath("1/environ")); err == nil {
+		for _, v := range bytes.Split(environ, []byte{0}) {
+			if name := bytes.TrimPrefix(v, []byte("container=")); len(name) != len(v) {
+				return string(name), "proc:1/environ"
+			}
+		}
+	}
+	if _, err := os.Stat(procPath("vz")); err == nil {
+		if _, err := os.Stat(procPath("bc")); os.IsNotExist(err) {
+			return "openvz", "proc:vz"
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, ".dockerenv")); err == nil {
+		return "docker", "file:.dockerenv"
+	}
+	if _, err := os.Stat(filepath.Join(root, "run/.containerenv")); err == nil {
+		return "podman", "file:run/.containerenv"
+	}
+	if release, err := readString(procPath("sys/kernel/osrelease")); err == nil {
+		if strings.Contains(release, "Microsoft") {
+			return "wsl", "proc:sys/kernel/osrelease"
+		}
+	}
+	return "", ""
+}
+
+// detectHypervisor returns the hypervisor we're running under and the
+// signal it was detected from, or empty strings if there's none. DMI is
+// checked first, then what Xen, device tree, s390x and finally the CPU
+// expose, which are less specific.
+func detectHypervisor() (string, string) {
+	for _, field := range dmiVirtFields {
+		value, err := readString(sysfsPath(dmiPath, field))
+		if err != nil {
+			continue
+		}
+		for _, h := range dmiHypervisors {
+			if strings.HasPrefix(value, h.prefix) {
+				return h.hypervisor, "dmi:" + field
+			}
+		}
+		// Hyper-V uses a vendor generic enough that the product is needed
+		// too.
+		if field == "sys_vendor" && value == "Microsoft Corporation" {
+			product, _ := readString(sysfsPath(dmiPath, "product_name"))
+			if product == "Virtual Machine" {
+				return "microsoft", "dmi:sys_vendor"
+			}
+		}
+	}
+	if hypervisor, err := readString(sysfsPath("hypervisor/type")); err == nil && hypervisor != "" {
+		return hypervisor, "sysfs:hypervisor/type"
+	}
+	if compatible, err := readString(procPath("device-tree/hypervisor/compatible")); err == nil {
+		if strings.Contains(compatible, "linux,kvm") {
+			return "kvm", "proc:device-tree/hypervisor/compatible"
+		}
+		if strings.Contains(compatible, "xen") {
+			return "xen", "proc:device-tree/hypervisor/compatible"
+		}
+	}
+	if sysinfo, err := ioutil.ReadFile(procPath("sysinfo")); err == nil {
+		// s390x reports its hypervisor in the "Control Program" line.
+		scanner := bufio.NewScanner(bytes.NewReader(sysinfo))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.Contains(line, "Control Program:") {
+				continue
+			}
+			if strings.Contains(line, "KVM") {
+				return "kvm", "sysinfo:control-program"
+			}
+			if strings.Contains(line, "z/VM") {
+				return "zvm", "sysinfo:control-program"
+			}
+		}
+	}
+	// The CPU flag tells us there is a hypervisor, but not which one.
+	if cpuinfo, err := ioutil.ReadFile(procPath("cpuinfo")); err == nil {
+		scanner := bufio.NewScanner(bytes.NewReader(cpuinfo))
+		for scanner.Scan() {
+			key, value, found := strings.Cut(scanner.Text(), ":")
+			if !found || strings.TrimSpace(key) != "flags" {
+				continue
+			}
+			for _, flag := range strings.Fields(value) {
+				if flag == "hypervisor" {
+					return "other", "cpuinfo:hypervisor"
+				}
+			}
+		}
+	}
+	return "", ""
+}
+
+// getVirtualization detects whether we're in a container, in a VM, or on
+// bare metal. Containers are checked first, since a container inside a VM
+// still mostly sees the VM's hardware. root is passed to detectContainer.
+func getVirtualization(root string) (*virtualization, error) {
+	if container, source := detectContainer(root); container != "" {
+		return &virtualization{
+			Type:      virtContainer,
+			Container: container,
+			Source:    source,
+		}, nil
+	}
+	if hypervisor, source := detectHypervisor(); hypervisor != "" {
+		return &virtualization{
+			Type:       virtVM,
+			Hypervisor: hypervisor,
+			Source:     source,
+		}, nil
+	}
+	return &virtualization{Type: virtBareMetal}, nil
+}
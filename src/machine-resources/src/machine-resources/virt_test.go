@@ -0,0 +1,44 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetVirtualization(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    virtualization
+	}{
+		{"bare-metal", virtualization{Type: virtBareMetal}},
+		{"kvm", virtualization{Type: virtVM, Hypervisor: "kvm", Source: "dmi:product_name"}},
+		{"hyperv", virtualization{Type: virtVM, Hypervisor: "microsoft", Source: "dmi:sys_vendor"}},
+		{"xen", virtualization{Type: virtVM, Hypervisor: "xen", Source: "sysfs:hypervisor/type"}},
+		{"cpu-flag", virtualization{Type: virtVM, Hypervisor: "other", Source: "cpuinfo:hypervisor"}},
+		{"zvm", virtualization{Type: virtVM, Hypervisor: "zvm", Source: "sysinfo:control-program"}},
+		// A container in a VM is reported as the container.
+		{"docker", virtualization{Type: virtContainer, Container: "docker", Source: "file:.dockerenv"}},
+		{"podman", virtualization{Type: virtContainer, Container: "podman", Source: "file:run/.containerenv"}},
+		{"systemd", virtualization{Type: virtContainer, Container: "lxc", Source: "file:run/systemd/container"}},
+		{"environ", virtualization{Type: virtContainer, Container: "systemd-nspawn", Source: "proc:1/environ"}},
+		{"openvz", virtualization{Type: virtContainer, Container: "openvz", Source: "proc:vz"}},
+		{"wsl", virtualization{Type: virtContainer, Container: "wsl", Source: "proc:sys/kernel/osrelease"}},
+	}
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			dir := filepath.Join("testdata", "virt", test.fixture)
+			useRoots(t, dir)
+			got, err := getVirtualization(filepath.Join(dir, "root"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, test.want) {
+				t.Errorf("getVirtualization() = %+v, want %+v", *got, test.want)
+			}
+		})
+	}
+}
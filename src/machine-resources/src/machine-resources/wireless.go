@@ -0,0 +1,190 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"bufio"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mdlayher/wifi"
+)
+
+// Frequency bands, as reported in network.interfaces.*.wireless.bands.
+const (
+	band2GHz  = "2.4GHz"
+	band5GHz  = "5GHz"
+	band6GHz  = "6GHz"
+	band60GHz = "60GHz"
+)
+
+// wireless is what a wireless interface's PHY supports and, if the
+// interface is associated, the network it's on.
+type wireless struct {
+	PHY       string   `json:"phy" yaml:"phy"`
+	Bands     []string `json:"bands,omitempty" yaml:"bands,omitempty"`
+	SSID      string   `json:"ssid,omitempty" yaml:"ssid,omitempty"`
+	SignalDBm *int     `json:"signal_dbm,omitempty" yaml:"signal_dbm,omitempty"`
+}
+
+// bandOf returns the band a frequency in MHz is in, or "" if it's in none
+// we know.
+func bandOf(mhz int) string {
+	switch {
+	case mhz >= 2400 && mhz < 2500:
+		return band2GHz
+	case mhz >= 5150 && mhz < 5950:
+		return band5GHz
+	case mhz >= 5950 && mhz < 7200:
+		return band6GHz
+	case mhz >= 57000 && mhz < 72000:
+		return band60GHz
+	}
+	return ""
+}
+
+// addBand adds the band of a frequency to bands, keeping them unique and in
+// frequency order.
+func addBand(bands []string, mhz int) []string {
+	band := bandOf(mhz)
+	if band == "" {
+		return bands
+	}
+	for _, b := range bands {
+		if b == band {
+			return bands
+		}
+	}
+	order := map[string]int{band2GHz: 0, band5GHz: 1, band6GHz: 2, band60GHz: 3}
+	bands = append(bands, band)
+	sort.Slice(bands, func(i, j int) bool { return order[bands[i]] < order[bands[j]] })
+	return bands
+}
+
+// getNetlinkWireless returns the wireless details of each interface nl80211
+// knows about, keyed by interface name.
+func getNetlinkWireless() (map[string]*wireless, error) {
+	client, err := wifi.New()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	phys, err := client.PHYs()
+	if err != nil {
+		return nil, err
+	}
+	ifis, err := client.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	details := make(map[string]*wireless)
+	for _, ifi := range ifis {
+		if ifi.Name == "" {
+			continue
+		}
+		w := &wireless{}
+		for _, phy := range phys {
+			if phy.Index != ifi.PHY {
+				continue
+			}
+			w.PHY = phy.Name
+			for _, band := range phy.BandAttributes {
+				for _, freq := range band.FrequencyAttributes {
+					w.Bands = addBand(w.Bands, freq.Frequency)
+				}
+			}
+		}
+		// BSS fails when the interface isn't connected to anything.
+		if bss, err := client.BSS(ifi); err == nil && bss.Status == wifi.BSSStatusAssociated {
+			w.SSID = bss.SSID
+			if stations, err := client.StationInfo(ifi); err == nil && len(stations) > 0 {
+				signal := stations[0].Signal
+				w.SignalDBm = &signal
+			}
+		}
+		details[ifi.Name] = w
+	}
+	return details, nil
+}
+
+// parseIWPhyBands returns the bands listed in `iw phy <phy> info` output,
+// going by the frequencies, which look like "* 2412 MHz [1] (20.0 dBm)".
+func parseIWPhyBands(data []byte) []string {
+	var bands []string
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[0] != "*" || fields[2] != "MHz" {
+			continue
+		}
+		// Frequencies are sometimes given with a decimal part.
+		mhz, err := strconv.ParseFloat(fields[1], 64)
+		if err == nil {
+			bands = addBand(bands, int(mhz))
+		}
+	}
+	return bands
+}
+
+// parseIWLink returns the SSID and signal strength from `iw dev <iface>
+// link` output, which says "Not connected." if there are none.
+func parseIWLink(data []byte) (string, *int) {
+	var ssid string
+	var signal *int
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if value := strings.TrimPrefix(line, "SSID: "); value != line {
+			ssid = value
+		} else if value := strings.TrimPrefix(line, "signal: "); value != line {
+			fields := strings.Fields(value)
+			if len(fields) > 0 {
+				if dbm, err := strconv.Atoi(fields[0]); err == nil {
+					signal = &dbm
+				}
+			}
+		}
+	}
+	return ssid, signal
+}
+
+// getIWWireless fills in w for the named interface from iw output, for when
+// nl80211 can't be used directly.
+func getIWWireless(run commandRunner, name string, w *wireless) {
+	if w.PHY != "" {
+		if data, err := run("iw", "phy", w.PHY, "info"); err == nil {
+			w.Bands = parseIWPhyBands(data)
+		}
+	}
+	if data, err := run("iw", "dev", name, "link"); err == nil {
+		w.SSID, w.SignalDBm = parseIWLink(data)
+	}
+}
+
+// addWirelessDetails fills in the wireless details of the interfaces that
+// have them, from nl80211 if possible and otherwise from iw.
+func addWirelessDetails(ifaces []networkInterface, run commandRunner) {
+	var netlink map[string]*wireless
+	for i := range ifaces {
+		iface := &ifaces[i]
+		if iface.Wireless == nil {
+			continue
+		}
+		if netlink == nil {
+			var err error
+			if netlink, err = getNetlinkWireless(); err != nil {
+				netlink = map[string]*wireless{}
+			}
+		}
+		if details, ok := netlink[iface.Name]; ok {
+			if details.PHY == "" {
+				details.PHY = iface.Wireless.PHY
+			}
+			iface.Wireless = details
+		} else {
+			getIWWireless(run, iface.Name, iface.Wireless)
+		}
+	}
+}
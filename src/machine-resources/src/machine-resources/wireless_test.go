@@ -0,0 +1,91 @@
+// Copyright 2019 Canonical Ltd.  This software is licensed under the
+// GNU Affero General Public License version 3 (see the file LICENSE).
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestBandOf(t *testing.T) {
+	tests := map[int]string{
+		2412:  band2GHz,
+		2484:  band2GHz,
+		5180:  band5GHz,
+		5825:  band5GHz,
+		5955:  band6GHz,
+		7115:  band6GHz,
+		58320: band60GHz,
+		900:   "",
+		5000:  "",
+	}
+	for mhz, want := range tests {
+		if got := bandOf(mhz); got != want {
+			t.Errorf("bandOf(%d) = %q, want %q", mhz, got, want)
+		}
+	}
+}
+
+func TestParseIWPhyBands(t *testing.T) {
+	bands := parseIWPhyBands(readTestFile(t, "testdata/wireless/iw-phy-info.txt"))
+	want := []string{band2GHz, band5GHz, band6GHz}
+	if !reflect.DeepEqual(bands, want) {
+		t.Errorf("parseIWPhyBands() = %v, want %v", bands, want)
+	}
+}
+
+func TestParseIWLink(t *testing.T) {
+	ssid, signal := parseIWLink(readTestFile(t, "testdata/wireless/iw-link.txt"))
+	if ssid != "Office 5G" || signal == nil || *signal != -52 {
+		t.Errorf("parseIWLink() = %q, %v; want \"Office 5G\", -52", ssid, signal)
+	}
+	ssid, signal = parseIWLink(readTestFile(t, "testdata/wireless/iw-link-disconnected.txt"))
+	if ssid != "" || signal != nil {
+		t.Errorf("parseIWLink() = %q, %v when not connected", ssid, signal)
+	}
+}
+
+func TestAddWirelessDetails(t *testing.T) {
+	// The interface names are made up, so that nl80211 doesn't know them
+	// even where it's available and the details come from iw.
+	ifaces := []networkInterface{
+		{Name: "eth0", Type: ifacePhysical},
+		{Name: "wlxtest0", Type: ifacePhysical, Wireless: &wireless{PHY: "phy0"}},
+		{Name: "wlxtest1", Type: ifacePhysical, Wireless: &wireless{}},
+	}
+	run := fakeRunner(map[string]fakeCommand{
+		"iw phy phy0 info":     {output: readTestFile(t, "testdata/wireless/iw-phy-info.txt")},
+		"iw dev wlxtest0 link": {output: readTestFile(t, "testdata/wireless/iw-link.txt")},
+		"iw dev wlxtest1 link": {output: readTestFile(t, "testdata/wireless/iw-link-disconnected.txt")},
+	})
+	addWirelessDetails(ifaces, run)
+	want := []networkInterface{
+		{Name: "eth0", Type: ifacePhysical},
+		{Name: "wlxtest0", Type: ifacePhysical, Wireless: &wireless{
+			PHY:       "phy0",
+			Bands:     []string{band2GHz, band5GHz, band6GHz},
+			SSID:      "Office 5G",
+			SignalDBm: intPtr(-52),
+		}},
+		// Without a PHY there's nothing to ask iw about bands.
+		{Name: "wlxtest1", Type: ifacePhysical, Wireless: &wireless{}},
+	}
+	if !reflect.DeepEqual(ifaces, want) {
+		t.Errorf("addWirelessDetails() gave\n%+v\nwant\n%+v", ifaces, want)
+	}
+}
+
+func TestAddWirelessDetailsNoIW(t *testing.T) {
+	ifaces := []networkInterface{
+		{Name: "wlxtest0", Type: ifacePhysical, Wireless: &wireless{PHY: "phy0"}},
+	}
+	addWirelessDetails(ifaces, fakeRunner(nil))
+	if want := (&wireless{PHY: "phy0"}); !reflect.DeepEqual(ifaces[0].Wireless, want) {
+		t.Errorf("without iw, wireless = %+v, want %+v", ifaces[0].Wireless, want)
+	}
+}
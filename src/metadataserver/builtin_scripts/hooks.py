@@ -170,7 +170,7 @@ def parse_interfaces_details(node):
         )
         return interfaces
 
-    details = json.loads(script_result.stdout)
+    details = unwrap_lxd_resources(json.loads(script_result.stdout))
     return _parse_interfaces(node, details)
 
 
@@ -431,6 +431,17 @@ def update_hardware_details(node, output, exit_status):
                 )
 
 
+def unwrap_lxd_resources(data):
+    """Return the resources from the parsed output of `LXD_SCRIPT`.
+
+    The machine-resources binary wraps its report in a versioned envelope,
+    unless it was run with --bare or predates the envelope.
+    """
+    if "api_version" in data:
+        return data["resources"]
+    return data
+
+
 def process_lxd_results(node, output, exit_status):
     """Process the results of `LXD_SCRIPT`.
 
@@ -448,6 +459,7 @@ def process_lxd_results(node, output, exit_status):
         data = json.loads(output.decode("utf-8"))
     except ValueError as e:
         raise ValueError(e.message + ": " + output)
+    data = unwrap_lxd_resources(data)
 
     # Update CPU details.
     node.cpu_count, node.cpu_speed, cpu_model, numa_nodes = _parse_cpuinfo(
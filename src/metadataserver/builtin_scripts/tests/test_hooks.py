@@ -53,6 +53,7 @@ from metadataserver.builtin_scripts.hooks import (
     get_dmi_data,
     NODE_INFO_SCRIPTS,
     parse_bootif_cmdline,
+    parse_interfaces_details,
     process_lxd_results,
     retag_node_for_hardware_by_modalias,
     set_virtual_tag,
@@ -1342,6 +1343,17 @@ class TestProcessLXDResults(MAASServerTestCase):
         node = reload_object(node)
         self.assertEqual(round(16691519488 / 1024 / 1024), node.memory)
 
+    def test__updates_memory_from_envelope(self):
+        node = factory.make_Node()
+        node.memory = random.randint(4096, 8192)
+        node.save()
+        self.patch(hooks_module, "update_node_network_information")
+
+        output = {"api_version": 1, "resources": SAMPLE_LXD_JSON}
+        process_lxd_results(node, json.dumps(output).encode("utf-8"), 0)
+        node = reload_object(node)
+        self.assertEqual(round(16691519488 / 1024 / 1024), node.memory)
+
     def test__updates_model_and_cpu_speed_from_name(self):
         node = factory.make_Node()
         node.cpu_speed = 9999
@@ -1447,6 +1459,41 @@ class TestProcessLXDResults(MAASServerTestCase):
         )
 
 
+class TestParseInterfacesDetails(MAASServerTestCase):
+    def make_lxd_result(self, node, output):
+        script_set = node.current_commissioning_script_set
+        script_result = script_set.find_script_result(
+            script_name=LXD_OUTPUT_NAME
+        )
+        if script_result is not None:
+            script_result.delete()
+        factory.make_ScriptResult(
+            script_set=script_set,
+            script_name=LXD_OUTPUT_NAME,
+            exit_status=0,
+            status=SCRIPT_STATUS.PASSED,
+            stdout=json.dumps(output).encode("utf-8"),
+        )
+
+    def test__parses_bare_resources(self):
+        node = factory.make_Node()
+        create_IPADDR_OUTPUT_NAME_script(node, IP_ADDR_OUTPUT)
+        self.make_lxd_result(node, SAMPLE_LXD_JSON)
+        details = parse_interfaces_details(node)
+        self.assertNotEqual({}, details)
+
+    def test__parses_resources_from_envelope(self):
+        node = factory.make_Node()
+        create_IPADDR_OUTPUT_NAME_script(node, IP_ADDR_OUTPUT)
+        self.make_lxd_result(node, SAMPLE_LXD_JSON)
+        bare_details = parse_interfaces_details(node)
+
+        self.make_lxd_result(
+            node, {"api_version": 1, "resources": SAMPLE_LXD_JSON}
+        )
+        self.assertEqual(bare_details, parse_interfaces_details(node))
+
+
 class TestUpdateNodePhysicalBlockDevices(MAASServerTestCase):
     def test__idempotent_block_devices(self):
         device_names = [